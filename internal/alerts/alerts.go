@@ -2,6 +2,7 @@ package alerts
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -12,6 +13,7 @@ import (
 	"logmojo/internal/ws"
 	"net/http"
 	"net/smtp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -21,6 +23,9 @@ var (
 	alertRules = make(map[string]*db.AlertRule)
 )
 
+// recentWindow is how far back log-based rules look for new entries
+const recentWindow = 10 * time.Minute // TODO: Make this configurable
+
 func StartAlertEngine() {
 	// Load alert rules from database
 	loadAlertRules()
@@ -141,22 +146,12 @@ func checkLogPatterns() {
 			continue
 		}
 
-		// Search logs for pattern matches (limit results for performance)
-		results, err := logs.Search(rule.LogPattern, rule.AppFilter, rule.LogFilter, "", "", 500)
-		if err != nil {
-			continue
-		}
+		// Search recent logs for pattern matches (limit results for performance)
+		results := searchRecent(rule, rule.LogPattern, 500)
 
-		// Filter results to only NEW entries from recent time window (not previously processed)
-		recentWindow := 10 * time.Minute
-		recentThreshold := time.Now().Add(-recentWindow)
+		// Filter results to only NEW entries (not previously processed)
 		var newMatches []logs.LogResult
 		for _, result := range results {
-			// Skip entries older than 10 minutes
-			if result.Timestamp.Before(recentThreshold) {
-				continue
-			}
-
 			// Create hash-based key for this log entry (shorter and more efficient)
 			entryHash := db.HashLogEntry(result.File, result.Message, result.Timestamp.Unix())
 
@@ -170,7 +165,11 @@ func checkLogPatterns() {
 
 		if len(newMatches) > 0 {
 			// Batch alerts for performance - don't send individual alerts for each match
-			message := fmt.Sprintf("Found %d new log pattern matches for '%s'", len(newMatches), rule.LogPattern)
+			pattern := rule.LogPattern
+			if pattern == "" {
+				pattern = rule.FieldFilter
+			}
+			message := fmt.Sprintf("Found %d new log pattern matches for '%s'", len(newMatches), pattern)
 			if len(newMatches) > 0 {
 				message += fmt.Sprintf(". Latest: %s", truncateString(newMatches[0].Message, 100))
 			}
@@ -189,6 +188,39 @@ func checkLogPatterns() {
 	}
 }
 
+// searchRecent returns the entries of the last recentWindow matching a rule,
+// newest first. Searches read one file after another, so the limit applies
+// per app: a single limit across all apps could be used up by the first.
+func searchRecent(rule *db.AlertRule, pattern string, limit int) []logs.LogResult {
+	apps := []string{rule.AppFilter}
+	if rule.AppFilter == "" {
+		apps = nil
+		for _, app := range config.Apps() {
+			apps = append(apps, app.Name)
+		}
+	}
+
+	from := time.Now().Add(-recentWindow)
+	var results []logs.LogResult
+	for _, app := range apps {
+		page, err := logs.Search(context.Background(), logs.SearchOptions{
+			Query:  pattern,
+			Regex:  true, // Rule patterns are regular expressions
+			App:    app,
+			Log:    rule.LogFilter,
+			Filter: rule.FieldFilter,
+			From:   from,
+			Limit:  limit,
+		})
+		if err != nil {
+			continue
+		}
+		results = append(results, page.Results...)
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Timestamp.After(results[j].Timestamp) })
+	return results
+}
+
 func checkExceptions() {
 	// Simplified exception patterns for better performance
 	exceptionPatterns := []string{
@@ -215,43 +247,96 @@ func checkExceptions() {
 			pattern = strings.Join(exceptionPatterns, "|")
 		}
 
-		// Search for exceptions using rule's log filter (empty means all logs)
-		results, err := logs.Search(pattern, rule.AppFilter, rule.LogFilter, "", "", 50)
-		if err != nil {
-			continue
-		}
+		// Search recent logs for exceptions using rule's log filter (empty means all logs)
+		results := searchRecent(rule, pattern, 50)
 
-		// Filter NEW exceptions from recent time window (not previously processed)
-		recentWindow := 10 * time.Minute // TODO: Make this configurable
-		recentThreshold := time.Now().Add(-recentWindow)
-		var newExceptions []logs.LogResult
+		// Group NEW exceptions (not previously processed) into issues
+		var newIssues, regressions []db.Issue
 		for _, result := range results {
-			// Skip entries older than 10 minutes
-			if result.Timestamp.Before(recentThreshold) {
+			// Create hash-based key for this log entry, kept apart from log
+			// pattern rules so a line they alerted on still becomes an issue
+			entryHash := db.HashLogEntry("exception:"+result.File, result.Message, result.Timestamp.Unix())
+
+			// Only include if we haven't processed this entry before
+			if db.IsEntryProcessed(entryHash) {
 				continue
 			}
+			// Mark as processed in database
+			db.MarkEntryProcessed(entryHash)
 
-			// Create hash-based key for this log entry
-			entryHash := db.HashLogEntry(result.File, result.Message, result.Timestamp.Unix())
-
-			// Only include if we haven't processed this entry before
-			if !db.IsEntryProcessed(entryHash) {
-				newExceptions = append(newExceptions, result)
-				// Mark as processed in database
-				db.MarkEntryProcessed(entryHash)
+			issue, isNew, regressed, err := recordIssue(result)
+			if err != nil {
+				log.Printf("[ALERTS] Failed to record issue: %v", err)
+				continue
+			}
+			if isNew {
+				newIssues = append(newIssues, issue)
+			} else if regressed {
+				regressions = append(regressions, issue)
 			}
 		}
 
-		if len(newExceptions) > 0 {
-			message := fmt.Sprintf("Detected %d new exceptions in logs", len(newExceptions))
-			if len(newExceptions) > 0 {
-				message += fmt.Sprintf(". Latest: %s", truncateString(newExceptions[0].Message, 100))
-			}
-			triggerAlert(rule, message)
+		// Only brand-new fingerprints and regressions of resolved issues alert
+		if len(newIssues) > 0 || len(regressions) > 0 {
+			triggerAlert(rule, issuesMessage(newIssues, regressions))
 		}
 	}
 }
 
+// recordIssue parses an exception out of a log result and counts it against
+// the issue with the same fingerprint
+func recordIssue(result logs.LogResult) (db.Issue, bool, bool, error) {
+	exc, _ := logs.ParseException(result.Message)
+	frames, err := json.Marshal(exc.Frames)
+	if err != nil {
+		return db.Issue{}, false, false, err
+	}
+	if exc.Frames == nil {
+		frames = []byte("[]")
+	}
+
+	return db.RecordIssueOccurrence(db.Issue{
+		Fingerprint: exc.Fingerprint,
+		App:         result.App,
+		Type:        exc.Type,
+		Message:     truncateString(exc.Message, 1000),
+		Frames:      frames,
+		Sample:      truncateString(result.Message, 4000),
+		File:        result.File,
+		Line:        result.Line,
+		LastSeen:    result.Timestamp,
+	})
+}
+
+// issuesMessage summarises new and regressed issues for an alert
+func issuesMessage(newIssues, regressions []db.Issue) string {
+	var parts []string
+	if n := len(newIssues); n == 1 {
+		parts = append(parts, "New issue")
+	} else if n > 1 {
+		parts = append(parts, fmt.Sprintf("%d new issues", n))
+	}
+	if n := len(regressions); n == 1 {
+		parts = append(parts, "regression of a resolved issue")
+	} else if n > 1 {
+		parts = append(parts, fmt.Sprintf("%d regressions of resolved issues", n))
+	}
+	message := strings.Join(parts, " and ")
+	message = strings.ToUpper(message[:1]) + message[1:]
+
+	var latest db.Issue
+	if len(newIssues) > 0 {
+		latest = newIssues[0]
+	} else {
+		latest = regressions[0]
+	}
+	title := latest.Message
+	if latest.Type != "" {
+		title = latest.Type + ": " + latest.Message
+	}
+	return fmt.Sprintf("%s in %s. Latest: %s", message, latest.App, truncateString(title, 100))
+}
+
 func triggerAlert(rule *db.AlertRule, message string) {
 	// No cooldown needed - duplicate detection handles spam prevention
 
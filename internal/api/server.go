@@ -1,12 +1,16 @@
 package api
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"logmojo/internal/alerts"
 	"logmojo/internal/auth"
 	"logmojo/internal/config"
 	"logmojo/internal/db"
+	"logmojo/internal/ingest"
 	"logmojo/internal/logger"
 	"logmojo/internal/logs"
 	"logmojo/internal/metrics"
@@ -35,6 +39,10 @@ func Setup(app *fiber.App) {
 	// Serve static files
 	app.Static("/public", "./public")
 
+	// Pushed logs authenticate with ingest tokens, not a login
+	app.Post("/api/ingest", ingest.Handler)
+	app.Post("/v1/logs", ingest.OTLPHandler)
+
 	// Auth
 	auth.CreateDefaultUser()
 	app.Use(auth.RequireLogin)
@@ -107,27 +115,92 @@ func Setup(app *fiber.App) {
 	})
 
 	apiGroup.Get("/logs/search", func(c *fiber.Ctx) error {
-		q := c.Query("q")
-		app := c.Query("app")
-		logName := c.Query("log")
-		file := c.Query("file")
-		level := c.Query("level")
-		limit := c.QueryInt("limit", 500)
+		opts, status, err := searchOptionsFromQuery(c)
+		if err != nil {
+			return c.Status(status).JSON(fiber.Map{"error": err.Error()})
+		}
+		if c.QueryBool("stream") {
+			return streamSearch(c, opts)
+		}
 
-		if app == "" || logName == "" {
-			return c.Status(400).JSON(fiber.Map{"error": "app and log parameters required"})
+		page, err := logs.Search(c.UserContext(), opts)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 		}
 
-		results, err := logs.Search(q, app, logName, file, level, limit)
+		return c.JSON(page)
+	})
+
+	apiGroup.Get("/logs/histogram", func(c *fiber.Ctx) error {
+		opts, status, err := searchOptionsFromQuery(c)
 		if err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+			return c.Status(status).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		var interval time.Duration
+		if v := c.Query("interval"); v != "" {
+			if secs, convErr := strconv.Atoi(v); convErr == nil {
+				interval = time.Duration(secs) * time.Second
+			} else if interval, err = time.ParseDuration(v); err != nil {
+				return c.Status(400).JSON(fiber.Map{"error": "invalid interval: use seconds or a duration like 5m"})
+			}
+			if interval < time.Second {
+				return c.Status(400).JSON(fiber.Map{"error": "interval must be at least 1s"})
+			}
+		}
+
+		hist, err := logs.SearchHistogram(c.UserContext(), opts, interval)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		return c.JSON(hist)
+	})
+
+	apiGroup.Get("/logs/patterns", func(c *fiber.Ctx) error {
+		opts, status, err := searchOptionsFromQuery(c)
+		if err != nil {
+			return c.Status(status).JSON(fiber.Map{"error": err.Error()})
 		}
 
-		if results == nil {
-			results = []logs.LogResult{}
+		patterns, err := logs.SearchPatterns(c.UserContext(), opts, c.QueryInt("limit", 50))
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 		}
 
-		return c.JSON(results)
+		return c.JSON(patterns)
+	})
+
+	apiGroup.Get("/logs/context", func(c *fiber.Ctx) error {
+		file := c.Query("file")
+		if file == "" {
+			return c.Status(400).JSON(fiber.Map{"error": "file parameter required"})
+		}
+		line := c.QueryInt("line", 0)
+		offset, err := strconv.ParseInt(c.Query("offset", "-1"), 10, 64)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid offset"})
+		}
+		if line <= 0 && offset < 0 {
+			return c.Status(400).JSON(fiber.Map{"error": "line or offset parameter required"})
+		}
+		apps := logs.ConfiguredFileApps(file)
+		if len(apps) == 0 {
+			return c.Status(404).JSON(fiber.Map{"error": "file not found"})
+		}
+
+		result, err := logs.Context(file, logs.ContextOptions{
+			Line:   line,
+			Offset: offset,
+			Before: c.QueryInt("before", 20),
+			After:  c.QueryInt("after", 20),
+			Apps:   apps,
+		})
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		return c.JSON(result)
 	})
 
 	app.Get("/processes", func(c *fiber.Ctx) error {
@@ -201,7 +274,7 @@ func Setup(app *fiber.App) {
 	api := app.Group("/api")
 
 	api.Get("/apps", func(c *fiber.Ctx) error {
-		return c.JSON(config.AppConfigData.Apps)
+		return c.JSON(config.Apps())
 	})
 
 	api.Get("/metrics/host", func(c *fiber.Ctx) error {
@@ -271,6 +344,18 @@ func Setup(app *fiber.App) {
 		return c.JSON(p)
 	})
 
+	// Docker containers, to find the name or labels of a docker log source
+	api.Get("/docker/containers", func(c *fiber.Ctx) error {
+		containers, err := logs.ListContainers(c.UserContext(), "")
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		if containers == nil {
+			containers = []logs.Container{}
+		}
+		return c.JSON(containers)
+	})
+
 	api.Post("/processes/kill", func(c *fiber.Ctx) error {
 		type KillReq struct {
 			PID  int32  `json:"pid"`
@@ -300,6 +385,223 @@ func Setup(app *fiber.App) {
 		return c.JSON(fiber.Map{"status": "ok"})
 	})
 
+	// Saved searches
+	api.Get("/searches", func(c *fiber.Ctx) error {
+		searches, err := db.GetSavedSearches()
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(searches)
+	})
+
+	api.Get("/searches/:id", func(c *fiber.Ctx) error {
+		search, err := db.GetSavedSearch(c.Params("id"))
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		if search == nil {
+			return c.Status(404).JSON(fiber.Map{"error": "Saved search not found"})
+		}
+		return c.JSON(search)
+	})
+
+	api.Post("/searches", func(c *fiber.Ctx) error {
+		var search db.SavedSearch
+		if err := c.BodyParser(&search); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+		if err := validateSavedSearch(search); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		search.ID = fmt.Sprintf("search_%d", time.Now().UnixNano())
+		search.Owner = c.Locals("username").(string)
+		search.CreatedAt = time.Now()
+		search.UpdatedAt = time.Now()
+
+		if err := db.CreateSavedSearch(search); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(search)
+	})
+
+	api.Put("/searches/:id", func(c *fiber.Ctx) error {
+		existing, err := db.GetSavedSearch(c.Params("id"))
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		if existing == nil {
+			return c.Status(404).JSON(fiber.Map{"error": "Saved search not found"})
+		}
+		if existing.Owner != c.Locals("username").(string) {
+			return c.Status(403).JSON(fiber.Map{"error": "Only the owner can change a saved search"})
+		}
+
+		var search db.SavedSearch
+		if err := c.BodyParser(&search); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+		if err := validateSavedSearch(search); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		search.ID = existing.ID
+		search.Owner = existing.Owner
+		search.CreatedAt = existing.CreatedAt
+		search.UpdatedAt = time.Now()
+
+		if err := db.UpdateSavedSearch(search); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(search)
+	})
+
+	api.Delete("/searches/:id", func(c *fiber.Ctx) error {
+		existing, err := db.GetSavedSearch(c.Params("id"))
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		if existing == nil {
+			return c.Status(404).JSON(fiber.Map{"error": "Saved search not found"})
+		}
+		if existing.Owner != c.Locals("username").(string) {
+			return c.Status(403).JSON(fiber.Map{"error": "Only the owner can delete a saved search"})
+		}
+
+		if err := db.DeleteSavedSearch(existing.ID); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(fiber.Map{"success": true})
+	})
+
+	// Turn a saved search into a log_pattern alert rule
+	api.Post("/searches/:id/alert", func(c *fiber.Ctx) error {
+		search, err := db.GetSavedSearch(c.Params("id"))
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		if search == nil {
+			return c.Status(404).JSON(fiber.Map{"error": "Saved search not found"})
+		}
+
+		var req struct {
+			Name         string `json:"name"`
+			Severity     string `json:"severity"`
+			EmailEnabled bool   `json:"email_enabled"`
+		}
+		c.BodyParser(&req) // Everything is optional
+
+		rule := db.AlertRule{
+			ID:           fmt.Sprintf("rule_%d", time.Now().UnixNano()),
+			Name:         req.Name,
+			Description:  fmt.Sprintf("Created from saved search %q", search.Name),
+			Type:         "log_pattern",
+			Severity:     req.Severity,
+			Enabled:      true,
+			EmailEnabled: req.EmailEnabled,
+			AppFilter:    search.App,
+			LogFilter:    search.Log,
+			CreatedAt:    time.Now(),
+			UpdatedAt:    time.Now(),
+		}
+		if rule.Name == "" {
+			rule.Name = search.Name
+		}
+		if rule.Severity == "" {
+			rule.Severity = "medium"
+		}
+
+		// Rule patterns are regexes; query-language searches go in the field filter
+		var filters []string
+		if search.Regex {
+			rule.LogPattern = search.Query
+		} else if search.Query != "" {
+			filters = append(filters, "("+search.Query+")")
+		}
+		if search.Level != "" {
+			filters = append(filters, "level:"+search.Level)
+		}
+		rule.FieldFilter = strings.Join(filters, " AND ")
+
+		if err := db.CreateAlertRule(rule); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		alerts.ReloadAlertRules()
+		ws.BroadcastRuleUpdate(rule)
+
+		return c.JSON(rule)
+	})
+
+	// Issues: exceptions grouped by fingerprint
+	api.Get("/issues", func(c *fiber.Ctx) error {
+		status := c.Query("status")
+		if status != "" && !validIssueStatus(status) {
+			return c.Status(400).JSON(fiber.Map{"error": "status must be open, ignored or resolved"})
+		}
+		limit := c.QueryInt("limit", 200)
+		if limit <= 0 || limit > 1000 {
+			limit = 1000
+		}
+
+		issues, err := db.GetIssues(status, c.Query("app"), limit)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(issues)
+	})
+
+	api.Get("/issues/:id", func(c *fiber.Ctx) error {
+		id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid issue ID"})
+		}
+
+		issue, err := db.GetIssue(id)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		if issue == nil {
+			return c.Status(404).JSON(fiber.Map{"error": "Issue not found"})
+		}
+		return c.JSON(issue)
+	})
+
+	api.Put("/issues/:id", func(c *fiber.Ctx) error {
+		id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid issue ID"})
+		}
+
+		var body struct {
+			Status string `json:"status"`
+		}
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+		if !validIssueStatus(body.Status) {
+			return c.Status(400).JSON(fiber.Map{"error": "status must be open, ignored or resolved"})
+		}
+
+		issue, err := db.GetIssue(id)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		if issue == nil {
+			return c.Status(404).JSON(fiber.Map{"error": "Issue not found"})
+		}
+
+		if err := db.UpdateIssueStatus(id, body.Status); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		issue, err = db.GetIssue(id)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(issue)
+	})
+
 	// Alert Rules API
 	api.Get("/alerts/rules", func(c *fiber.Ctx) error {
 		rules, err := db.GetAlertRules()
@@ -314,6 +616,9 @@ func Setup(app *fiber.App) {
 		if err := c.BodyParser(&rule); err != nil {
 			return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
 		}
+		if _, err := logs.ParseQuery(rule.FieldFilter); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid field filter: " + err.Error()})
+		}
 
 		rule.ID = fmt.Sprintf("rule_%d", time.Now().UnixNano())
 		rule.CreatedAt = time.Now()
@@ -338,6 +643,9 @@ func Setup(app *fiber.App) {
 		if err := c.BodyParser(&rule); err != nil {
 			return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
 		}
+		if _, err := logs.ParseQuery(rule.FieldFilter); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid field filter: " + err.Error()})
+		}
 
 		// Get existing rule to preserve CreatedAt
 		existingRules, err := db.GetAlertRules()
@@ -512,6 +820,11 @@ func Setup(app *fiber.App) {
 		return c.JSON(settings)
 	})
 
+	// Redaction rules and how often each masked a value since startup
+	api.Get("/redaction", func(c *fiber.Ctx) error {
+		return c.JSON(logs.RedactionStats())
+	})
+
 	api.Get("/system/info", func(c *fiber.Ctx) error {
 		m, err := metrics.GetHostMetrics()
 		if err != nil {
@@ -591,11 +904,16 @@ func Setup(app *fiber.App) {
 		serviceName := c.Params("service")
 		lines := c.QueryInt("lines", 50)
 
-		logs, err := services.GetServiceLogs(serviceName, lines)
+		serviceLogs, err := services.GetServiceLogs(serviceName, lines)
 		if err != nil {
 			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 		}
-		return c.JSON(fiber.Map{"logs": logs})
+		// Global rules, and those of the app the service belongs to
+		appName := serviceApp(serviceName)
+		for i, line := range serviceLogs {
+			serviceLogs[i] = logs.Redact(appName, line)
+		}
+		return c.JSON(fiber.Map{"logs": serviceLogs})
 	})
 
 	// WebSocket
@@ -625,3 +943,191 @@ func Setup(app *fiber.App) {
 	})
 
 }
+
+// validateSavedSearch checks that a saved search can be run
+func validateSavedSearch(s db.SavedSearch) error {
+	if strings.TrimSpace(s.Name) == "" {
+		return fmt.Errorf("name is required")
+	}
+	if s.App == "" || s.Log == "" {
+		return fmt.Errorf("app and log are required")
+	}
+	if s.Regex {
+		if _, err := logs.RegexQuery(s.Query); err != nil {
+			return err
+		}
+	} else if _, err := logs.ParseQuery(s.Query); err != nil {
+		return err
+	}
+	for _, v := range []string{s.From, s.To} {
+		if _, err := parseTimeParam(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// searchOptionsFromQuery reads the search filters shared by the log search
+// endpoints. On error it also returns the HTTP status to respond with.
+func searchOptionsFromQuery(c *fiber.Ctx) (logs.SearchOptions, int, error) {
+	opts := logs.SearchOptions{
+		Query:  c.Query("q"),
+		App:    c.Query("app"),
+		Log:    c.Query("log"),
+		File:   c.Query("file"),
+		Level:  c.Query("level"),
+		Regex:  c.QueryBool("regex"),
+		Limit:  c.QueryInt("limit", 500),
+		Cursor: c.Query("cursor"),
+		Facets: c.QueryInt("facets", 0),
+	}
+
+	if opts.App == "" || opts.Log == "" {
+		return opts, 400, fmt.Errorf("app and log parameters required")
+	}
+
+	var err error
+	if opts.From, err = parseTimeParam(c.Query("from")); err != nil {
+		return opts, 400, fmt.Errorf("invalid from: %w", err)
+	}
+	if opts.To, err = parseTimeParam(c.Query("to")); err != nil {
+		return opts, 400, fmt.Errorf("invalid to: %w", err)
+	}
+	if !opts.From.IsZero() && !opts.To.IsZero() && opts.To.Before(opts.From) {
+		return opts, 400, fmt.Errorf("to must not be before from")
+	}
+	if opts.File != "" && !logs.IsLogFile(opts.App, opts.Log, opts.File) {
+		return opts, 404, fmt.Errorf("file not found")
+	}
+	return opts, 0, nil
+}
+
+// validIssueStatus reports whether status is one an issue can be set to
+func validIssueStatus(status string) bool {
+	switch status {
+	case "open", "ignored", "resolved":
+		return true
+	}
+	return false
+}
+
+// serviceApp returns the app a systemd service belongs to, if any
+func serviceApp(serviceName string) string {
+	for _, app := range config.Apps() {
+		if app.ServiceName == serviceName {
+			return app.Name
+		}
+		for _, s := range app.Services {
+			if s.ServiceName == serviceName {
+				return app.Name
+			}
+		}
+	}
+	return ""
+}
+
+// parseTimeParam parses a from/to query value. It accepts RFC 3339, Unix seconds,
+// times relative to now such as "now-1h", and zone-less date-times, which are
+// read as UTC like zone-less log timestamps.
+func parseTimeParam(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	// Relative to now: "now", "now-15m" or "-15m"
+	if value == "now" {
+		return time.Now(), nil
+	}
+	if rel := strings.TrimPrefix(value, "now"); strings.HasPrefix(rel, "-") {
+		d, err := time.ParseDuration(rel[1:])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid relative time %q", value)
+		}
+		return time.Now().Add(-d), nil
+	}
+	if secs, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	layouts := []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02 15:04"}
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unsupported time format %q", value)
+}
+
+// streamSearch writes search results as NDJSON while files are scanned. Lines
+// are {"type":"results"} batches, {"type":"progress"} heartbeats and finally
+// {"type":"done"} with the cursor, or {"type":"error"}. The heartbeat makes a
+// disconnected client show up as a failed write, which cancels the search.
+func streamSearch(c *fiber.Ctx, opts logs.SearchOptions) error {
+	c.Set("Content-Type", "application/x-ndjson")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("X-Accel-Buffering", "no")
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		events := make(chan fiber.Map)
+		go func() {
+			defer close(events)
+			send := func(ev fiber.Map) error {
+				select {
+				case events <- ev:
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+
+			page, err := logs.SearchStream(ctx, opts, func(page *logs.SearchPage, results []logs.LogResult) error {
+				return send(fiber.Map{
+					"type":          "results",
+					"results":       results,
+					"files_scanned": page.FilesScanned,
+					"files_total":   page.FilesTotal,
+				})
+			})
+			if err != nil {
+				send(fiber.Map{"type": "error", "error": err.Error()})
+				return
+			}
+			done := fiber.Map{
+				"type":          "done",
+				"next":          page.Next,
+				"files_scanned": page.FilesScanned,
+				"files_total":   page.FilesTotal,
+				"truncated":     page.Truncated,
+			}
+			if page.Facets != nil {
+				done["facets"] = page.Facets
+			}
+			send(done)
+		}()
+
+		heartbeat := time.NewTicker(time.Second)
+		defer heartbeat.Stop()
+		enc := json.NewEncoder(w)
+		for {
+			var ev fiber.Map
+			select {
+			case e, ok := <-events:
+				if !ok {
+					return
+				}
+				ev = e
+			case <-heartbeat.C:
+				ev = fiber.Map{"type": "progress"}
+			}
+			if err := enc.Encode(ev); err != nil {
+				return
+			}
+			if err := w.Flush(); err != nil {
+				log.Printf("[API] Search stream closed by client, cancelling search")
+				return
+			}
+		}
+	})
+	return nil
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"log"
 	"strings"
+	"sync"
 
 	"github.com/joho/godotenv"
 	"github.com/spf13/viper"
@@ -15,6 +16,9 @@ type Config struct {
 	Services  []ServiceConfig `mapstructure:"services"`
 	Apps      []AppConfig     `mapstructure:"apps"`
 	Notifiers NotifiersConfig `mapstructure:"notifiers"`
+	Syslog    SyslogConfig    `mapstructure:"syslog"`
+	Ingest    IngestConfig    `mapstructure:"ingest"`
+	Redaction []RedactionRule `mapstructure:"redaction"` // Rules applied to every app
 	General   GeneralConfig   `mapstructure:"general"`
 }
 
@@ -39,6 +43,7 @@ type AppConfig struct {
 	ServiceName string          `mapstructure:"service_name" json:"service_name"`
 	Logs        []LogConfig     `mapstructure:"logs" json:"logs"`
 	Services    []ServiceConfig `mapstructure:"services" json:"services"`
+	Redact      []RedactionRule `mapstructure:"redact" json:"-"` // Rules for this app's logs only
 }
 
 type ServiceConfig struct {
@@ -51,8 +56,90 @@ type ServiceConfig struct {
 }
 
 type LogConfig struct {
-	Name string `mapstructure:"name" json:"name"`
-	Path string `mapstructure:"path" json:"path"`
+	Name      string          `mapstructure:"name" json:"name"`
+	Type      string          `mapstructure:"type" json:"type,omitempty"`           // file (default), journal or docker
+	Unit      string          `mapstructure:"unit" json:"unit,omitempty"`           // systemd unit of a journal source
+	Container string          `mapstructure:"container" json:"container,omitempty"` // Name, name glob or ID prefix of a docker source
+	Labels    []string        `mapstructure:"labels" json:"labels,omitempty"`       // "key" or "key=value" labels a container must have
+	Path      string          `mapstructure:"path" json:"path"`                     // File, directory or glob (** spans directories)
+	Recursive bool            `mapstructure:"recursive" json:"recursive,omitempty"` // Scan subdirectories of a directory path
+	Include   []string        `mapstructure:"include" json:"include,omitempty"`     // Globs files must match; default is any log-like name
+	Exclude   []string        `mapstructure:"exclude" json:"exclude,omitempty"`     // Globs of files to skip
+	Format    string          `mapstructure:"format" json:"format,omitempty"`       // plain, json, logfmt or auto (default)
+	Unordered bool            `mapstructure:"unordered" json:"unordered,omitempty"` // Lines are not in time order, so time-bounded searches read whole files
+	Multiline MultilineConfig `mapstructure:"multiline" json:"multiline"`
+	Parser    *ParserConfig   `mapstructure:"parser" json:"parser,omitempty"`
+}
+
+// ParserConfig is a custom line format for a log source. Pattern is a regular
+// expression with named groups; Grok is the same written with %{NAME:field}
+// references to the built-in pattern library and Patterns. The groups
+// timestamp, level and message fill the matching LogResult fields, any other
+// group becomes a structured field.
+type ParserConfig struct {
+	Pattern         string            `mapstructure:"pattern" json:"pattern,omitempty"`
+	Grok            string            `mapstructure:"grok" json:"grok,omitempty"`
+	Patterns        map[string]string `mapstructure:"patterns" json:"patterns,omitempty"`                 // Extra grok definitions
+	TimestampLayout string            `mapstructure:"timestamp_layout" json:"timestamp_layout,omitempty"` // Go layout, e.g. 2006-01-02 15:04:05.000
+	Timezone        string            `mapstructure:"timezone" json:"timezone,omitempty"`                 // IANA name for timestamps without an offset (default UTC)
+}
+
+// MultilineConfig folds stack traces and other continuation lines into one event.
+// Mode is "timestamp" (lines starting with a timestamp begin an event),
+// "continuation" (lines matching Pattern belong to the previous event) or
+// "start" (lines matching Pattern begin an event). Empty disables grouping.
+type MultilineConfig struct {
+	Mode     string `mapstructure:"mode" json:"mode,omitempty"`
+	Pattern  string `mapstructure:"pattern" json:"pattern,omitempty"`
+	MaxLines int    `mapstructure:"max_lines" json:"max_lines,omitempty"`
+}
+
+// RedactionRule masks sensitive values in log content before it leaves the
+// server. Detector names a built-in pattern (email, credit_card, jwt, bearer,
+// aws_access_key, password); Pattern is a custom regular expression, of which
+// only the first group is replaced if it has one.
+type RedactionRule struct {
+	Name        string `mapstructure:"name"` // Default is the detector
+	Detector    string `mapstructure:"detector"`
+	Pattern     string `mapstructure:"pattern"`
+	Replacement string `mapstructure:"replacement"` // Default [REDACTED:<name>]
+}
+
+// SyslogConfig is the built-in syslog receiver. Messages are written to
+// Dir/<host>/<app>.log and registered as logs of the app named App.
+type SyslogConfig struct {
+	Enabled     bool   `mapstructure:"enabled"`
+	UDPAddr     string `mapstructure:"udp_addr"` // Empty disables UDP
+	TCPAddr     string `mapstructure:"tcp_addr"` // Empty disables TCP
+	Dir         string `mapstructure:"dir"`
+	App         string `mapstructure:"app"`
+	MaxFileSize int    `mapstructure:"max_file_size"` // MB before a file is rotated
+	MaxFiles    int    `mapstructure:"max_files"`     // Rotations kept per file
+	MaxHosts    int    `mapstructure:"max_hosts"`     // Hosts with a log of their own, 0 for no limit
+}
+
+// IngestConfig is the HTTP ingestion endpoint. Events pushed with a source's
+// token are written to Dir/<app>/<log>.log and registered as that app's log.
+type IngestConfig struct {
+	Dir         string         `mapstructure:"dir"`
+	MaxFileSize int            `mapstructure:"max_file_size"` // MB before a file is rotated
+	MaxFiles    int            `mapstructure:"max_files"`     // Rotations kept per file
+	Sources     []IngestSource `mapstructure:"sources"`
+	OTLP        OTLPConfig     `mapstructure:"otlp"`
+}
+
+type IngestSource struct {
+	App   string `mapstructure:"app"`
+	Log   string `mapstructure:"log"` // Default "Ingest"
+	Token string `mapstructure:"token"`
+}
+
+// OTLPConfig is the OpenTelemetry logs receiver on /v1/logs. Records are
+// stored per service.name and shown under the app of that name.
+type OTLPConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Token   string `mapstructure:"token"` // Bearer token exporters must send; required when enabled
+	App     string `mapstructure:"app"`   // App of the "All services" log
 }
 
 type NotifiersConfig struct {
@@ -77,6 +164,38 @@ type WebhookConfig struct {
 
 var AppConfigData Config
 
+// appsMu guards AppConfigData.Apps, which receivers extend while running
+var appsMu sync.RWMutex
+
+// Apps returns the configured apps. The returned slice is never modified in
+// place, so it stays valid while receivers register new logs.
+func Apps() []AppConfig {
+	appsMu.RLock()
+	defer appsMu.RUnlock()
+	return AppConfigData.Apps
+}
+
+// RegisterLogs adds log sources to the named app, creating the app if there
+// is none. Receivers call it at startup and when a new host or service first
+// sends.
+func RegisterLogs(appName string, sources ...LogConfig) {
+	appsMu.Lock()
+	defer appsMu.Unlock()
+
+	// Copy on write, as readers keep the slice Apps returned
+	apps := make([]AppConfig, len(AppConfigData.Apps), len(AppConfigData.Apps)+1)
+	copy(apps, AppConfigData.Apps)
+	for i := range apps {
+		if apps[i].Name == appName {
+			logs := make([]LogConfig, 0, len(apps[i].Logs)+len(sources))
+			apps[i].Logs = append(append(logs, apps[i].Logs...), sources...)
+			AppConfigData.Apps = apps
+			return
+		}
+	}
+	AppConfigData.Apps = append(apps, AppConfig{Name: appName, Logs: sources})
+}
+
 func Load() error {
 	// Load .env file if it exists (ignore errors if file doesn't exist)
 	if err := godotenv.Load(); err != nil {
@@ -128,4 +247,21 @@ func setDefaults() {
 	viper.SetDefault("notifiers.webhook.enabled", false)
 	viper.SetDefault("notifiers.webhook.url", "")
 
+	// Syslog receiver defaults
+	viper.SetDefault("syslog.enabled", false)
+	viper.SetDefault("syslog.udp_addr", "0.0.0.0:514")
+	viper.SetDefault("syslog.tcp_addr", "0.0.0.0:514")
+	viper.SetDefault("syslog.dir", "./syslog")
+	viper.SetDefault("syslog.app", "Syslog")
+	viper.SetDefault("syslog.max_file_size", 100)
+	viper.SetDefault("syslog.max_files", 5)
+	viper.SetDefault("syslog.max_hosts", 500)
+
+	// Ingest defaults
+	viper.SetDefault("ingest.dir", "./ingest")
+	viper.SetDefault("ingest.max_file_size", 100)
+	viper.SetDefault("ingest.max_files", 5)
+	viper.SetDefault("ingest.otlp.enabled", false)
+	viper.SetDefault("ingest.otlp.app", "OpenTelemetry")
+
 }
@@ -19,6 +19,7 @@ type AlertRule struct {
 	LogPattern   string    `json:"log_pattern" db:"log_pattern"`
 	AppFilter    string    `json:"app_filter" db:"app_filter"`
 	LogFilter    string    `json:"log_filter" db:"log_filter"`
+	FieldFilter  string    `json:"field_filter" db:"field_filter"`
 	CreatedAt    time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
 	LastTriggered *time.Time `json:"last_triggered" db:"last_triggered"`
@@ -51,7 +52,7 @@ func GetAlertRules() ([]AlertRule, error) {
 	}
 	
 	rows, err := DB.Query(`SELECT id, name, description, type, condition, threshold, severity, 
-							 enabled, email_enabled, log_pattern, app_filter, log_filter, 
+							 enabled, email_enabled, log_pattern, app_filter, log_filter, field_filter, 
 							 created_at, updated_at, last_triggered 
 						 FROM alert_rules ORDER BY created_at DESC`)
 	if err != nil {
@@ -65,7 +66,7 @@ func GetAlertRules() ([]AlertRule, error) {
 		var lastTriggered sql.NullTime
 		err := rows.Scan(&rule.ID, &rule.Name, &rule.Description, &rule.Type, &rule.Condition,
 			&rule.Threshold, &rule.Severity, &rule.Enabled, &rule.EmailEnabled,
-			&rule.LogPattern, &rule.AppFilter, &rule.LogFilter,
+			&rule.LogPattern, &rule.AppFilter, &rule.LogFilter, &rule.FieldFilter,
 			&rule.CreatedAt, &rule.UpdatedAt, &lastTriggered)
 		if err != nil {
 			return nil, err
@@ -83,12 +84,12 @@ func CreateAlertRule(rule AlertRule) error {
 		return fmt.Errorf("database not initialized")
 	}
 	_, err := DB.Exec(`INSERT INTO alert_rules (id, name, description, type, condition, threshold, 
-						 severity, enabled, email_enabled, log_pattern, app_filter, log_filter, 
+						 severity, enabled, email_enabled, log_pattern, app_filter, log_filter, field_filter, 
 						 created_at, updated_at) 
-					 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+					 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		rule.ID, rule.Name, rule.Description, rule.Type, rule.Condition, rule.Threshold,
 		rule.Severity, rule.Enabled, rule.EmailEnabled, rule.LogPattern, rule.AppFilter,
-		rule.LogFilter, rule.CreatedAt, rule.UpdatedAt)
+		rule.LogFilter, rule.FieldFilter, rule.CreatedAt, rule.UpdatedAt)
 	return err
 }
 
@@ -98,10 +99,10 @@ func UpdateAlertRule(rule AlertRule) error {
 	}
 	_, err := DB.Exec(`UPDATE alert_rules SET name=?, description=?, type=?, condition=?, threshold=?, 
 						 severity=?, enabled=?, email_enabled=?, log_pattern=?, app_filter=?, log_filter=?, 
-						 updated_at=? WHERE id=?`,
+						 field_filter=?, updated_at=? WHERE id=?`,
 		rule.Name, rule.Description, rule.Type, rule.Condition, rule.Threshold,
 		rule.Severity, rule.Enabled, rule.EmailEnabled, rule.LogPattern, rule.AppFilter,
-		rule.LogFilter, rule.UpdatedAt, rule.ID)
+		rule.LogFilter, rule.FieldFilter, rule.UpdatedAt, rule.ID)
 	return err
 }
 
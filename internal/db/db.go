@@ -74,6 +74,38 @@ func migrate() error {
 		);`,
 		`CREATE INDEX IF NOT EXISTS idx_processed_entries_hash ON processed_log_entries(entry_hash);`,
 		`CREATE INDEX IF NOT EXISTS idx_processed_entries_time ON processed_log_entries(processed_at);`,
+		`CREATE TABLE IF NOT EXISTS saved_searches (
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			owner TEXT,
+			query TEXT,
+			regex BOOLEAN DEFAULT 0,
+			app TEXT,
+			log TEXT,
+			level TEXT,
+			time_from TEXT,
+			time_to TEXT,
+			created_at DATETIME,
+			updated_at DATETIME
+		);`,
+		`CREATE TABLE IF NOT EXISTS issues (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			fingerprint TEXT NOT NULL,
+			app TEXT NOT NULL DEFAULT '',
+			type TEXT DEFAULT '',
+			message TEXT DEFAULT '',
+			frames TEXT DEFAULT '[]',
+			sample TEXT DEFAULT '',
+			file TEXT DEFAULT '',
+			line INTEGER DEFAULT 0,
+			first_seen DATETIME,
+			last_seen DATETIME,
+			count INTEGER DEFAULT 0,
+			status TEXT DEFAULT 'open',
+			resolved_at DATETIME,
+			UNIQUE(fingerprint, app)
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_issues_last_seen ON issues(last_seen);`,
 		`CREATE TABLE IF NOT EXISTS app_settings (
 			id INTEGER PRIMARY KEY,
 			app_name TEXT,
@@ -94,6 +126,7 @@ func migrate() error {
 		`ALTER TABLE alerts ADD COLUMN rule_id TEXT;`,
 		`ALTER TABLE alerts ADD COLUMN severity TEXT DEFAULT 'medium';`,
 		`ALTER TABLE alerts ADD COLUMN resolved_at DATETIME;`,
+		`ALTER TABLE alert_rules ADD COLUMN field_filter TEXT DEFAULT '';`,
 	}
 	
 	for _, q := range migrationQueries {
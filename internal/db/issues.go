@@ -0,0 +1,169 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Issue is a group of exceptions with the same fingerprint in one app
+type Issue struct {
+	ID          int64           `json:"id" db:"id"`
+	Fingerprint string          `json:"fingerprint" db:"fingerprint"`
+	App         string          `json:"app" db:"app"`
+	Type        string          `json:"type" db:"type"`
+	Message     string          `json:"message" db:"message"`
+	Frames      json.RawMessage `json:"frames" db:"frames"`
+	Sample      string          `json:"sample" db:"sample"` // Latest occurrence
+	File        string          `json:"file" db:"file"`
+	Line        int             `json:"line" db:"line"`
+	FirstSeen   time.Time       `json:"first_seen" db:"first_seen"`
+	LastSeen    time.Time       `json:"last_seen" db:"last_seen"`
+	Count       int             `json:"count" db:"count"`
+	Status      string          `json:"status" db:"status"` // open, ignored or resolved
+	ResolvedAt  *time.Time      `json:"resolved_at" db:"resolved_at"`
+}
+
+const issueColumns = `id, fingerprint, app, type, message, frames, sample, file, line, first_seen, last_seen, count, status, resolved_at`
+
+func scanIssue(row interface{ Scan(...interface{}) error }) (Issue, error) {
+	var i Issue
+	var frames string
+	var resolvedAt sql.NullTime
+	err := row.Scan(&i.ID, &i.Fingerprint, &i.App, &i.Type, &i.Message, &frames, &i.Sample, &i.File, &i.Line,
+		&i.FirstSeen, &i.LastSeen, &i.Count, &i.Status, &resolvedAt)
+	if err != nil {
+		return i, err
+	}
+	if frames == "" {
+		frames = "[]"
+	}
+	i.Frames = json.RawMessage(frames)
+	if resolvedAt.Valid {
+		i.ResolvedAt = &resolvedAt.Time
+	}
+	return i, nil
+}
+
+// GetIssues returns issues, most recently seen first. Empty filters match all.
+func GetIssues(status, app string, limit int) ([]Issue, error) {
+	if DB == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	rows, err := DB.Query(`SELECT `+issueColumns+` FROM issues
+						 WHERE (?='' OR status=?) AND (?='' OR app=?)
+						 ORDER BY last_seen DESC LIMIT ?`, status, status, app, app, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	issues := []Issue{}
+	for rows.Next() {
+		i, err := scanIssue(rows)
+		if err != nil {
+			return nil, err
+		}
+		issues = append(issues, i)
+	}
+	return issues, rows.Err()
+}
+
+// GetIssue returns the issue with the given ID, or nil if there is none
+func GetIssue(id int64) (*Issue, error) {
+	if DB == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	i, err := scanIssue(DB.QueryRow(`SELECT `+issueColumns+` FROM issues WHERE id=?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+// RecordIssueOccurrence adds one occurrence of an exception to its issue,
+// creating the issue if the fingerprint is new to the app. A resolved issue
+// that occurs again after it was resolved is reopened as a regression.
+// Ignored issues keep counting but stay ignored.
+func RecordIssueOccurrence(occ Issue) (issue Issue, isNew, regressed bool, err error) {
+	if DB == nil {
+		return occ, false, false, fmt.Errorf("database not initialized")
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return occ, false, false, err
+	}
+	defer tx.Rollback()
+
+	existing, err := scanIssue(tx.QueryRow(`SELECT `+issueColumns+` FROM issues WHERE fingerprint=? AND app=?`,
+		occ.Fingerprint, occ.App))
+	switch {
+	case err == sql.ErrNoRows:
+		occ.Count = 1
+		occ.Status = "open"
+		occ.FirstSeen = occ.LastSeen
+		res, err := tx.Exec(`INSERT INTO issues (fingerprint, app, type, message, frames, sample, file, line,
+							 first_seen, last_seen, count, status) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			occ.Fingerprint, occ.App, occ.Type, occ.Message, string(occ.Frames), occ.Sample, occ.File, occ.Line,
+			occ.FirstSeen, occ.LastSeen, occ.Count, occ.Status)
+		if err != nil {
+			return occ, false, false, err
+		}
+		if occ.ID, err = res.LastInsertId(); err != nil {
+			return occ, false, false, err
+		}
+		return occ, true, false, tx.Commit()
+	case err != nil:
+		return occ, false, false, err
+	}
+
+	issue = existing
+	issue.Count++
+	if occ.LastSeen.Before(issue.FirstSeen) {
+		issue.FirstSeen = occ.LastSeen
+	}
+	if !occ.LastSeen.Before(issue.LastSeen) {
+		issue.LastSeen = occ.LastSeen
+		issue.Message = occ.Message
+		issue.Frames = occ.Frames
+		issue.Sample = occ.Sample
+		issue.File = occ.File
+		issue.Line = occ.Line
+	}
+	if issue.Status == "resolved" && issue.ResolvedAt != nil && occ.LastSeen.After(*issue.ResolvedAt) {
+		issue.Status = "open"
+		issue.ResolvedAt = nil
+		regressed = true
+	}
+
+	_, err = tx.Exec(`UPDATE issues SET message=?, frames=?, sample=?, file=?, line=?, first_seen=?, last_seen=?,
+					 count=?, status=?, resolved_at=? WHERE id=?`,
+		issue.Message, string(issue.Frames), issue.Sample, issue.File, issue.Line, issue.FirstSeen, issue.LastSeen,
+		issue.Count, issue.Status, issue.ResolvedAt, issue.ID)
+	if err != nil {
+		return issue, false, false, err
+	}
+	return issue, false, regressed, tx.Commit()
+}
+
+// UpdateIssueStatus sets the status of an issue, recording when it was resolved
+func UpdateIssueStatus(id int64, status string) error {
+	if DB == nil {
+		return fmt.Errorf("database not initialized")
+	}
+
+	var resolvedAt *time.Time
+	if status == "resolved" {
+		now := time.Now()
+		resolvedAt = &now
+	}
+	_, err := DB.Exec("UPDATE issues SET status=?, resolved_at=? WHERE id=?", status, resolvedAt, id)
+	return err
+}
@@ -0,0 +1,99 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// SavedSearch is a named set of log search parameters. From and To are kept
+// as entered so relative ranges like "now-1h" stay relative.
+type SavedSearch struct {
+	ID        string    `json:"id" db:"id"`
+	Name      string    `json:"name" db:"name"`
+	Owner     string    `json:"owner" db:"owner"`
+	Query     string    `json:"query" db:"query"`
+	Regex     bool      `json:"regex" db:"regex"`
+	App       string    `json:"app" db:"app"`
+	Log       string    `json:"log" db:"log"`
+	Level     string    `json:"level" db:"level"`
+	From      string    `json:"from" db:"time_from"`
+	To        string    `json:"to" db:"time_to"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+const savedSearchColumns = `id, name, owner, query, regex, app, log, level, time_from, time_to, created_at, updated_at`
+
+func scanSavedSearch(row interface{ Scan(...interface{}) error }) (SavedSearch, error) {
+	var s SavedSearch
+	err := row.Scan(&s.ID, &s.Name, &s.Owner, &s.Query, &s.Regex, &s.App, &s.Log, &s.Level,
+		&s.From, &s.To, &s.CreatedAt, &s.UpdatedAt)
+	return s, err
+}
+
+func GetSavedSearches() ([]SavedSearch, error) {
+	if DB == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	rows, err := DB.Query(`SELECT ` + savedSearchColumns + ` FROM saved_searches ORDER BY name COLLATE NOCASE`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	searches := []SavedSearch{}
+	for rows.Next() {
+		s, err := scanSavedSearch(rows)
+		if err != nil {
+			return nil, err
+		}
+		searches = append(searches, s)
+	}
+	return searches, rows.Err()
+}
+
+// GetSavedSearch returns the saved search with the given ID, or nil if there is none
+func GetSavedSearch(id string) (*SavedSearch, error) {
+	if DB == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	s, err := scanSavedSearch(DB.QueryRow(`SELECT `+savedSearchColumns+` FROM saved_searches WHERE id=?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func CreateSavedSearch(s SavedSearch) error {
+	if DB == nil {
+		return fmt.Errorf("database not initialized")
+	}
+	_, err := DB.Exec(`INSERT INTO saved_searches (`+savedSearchColumns+`)
+					 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		s.ID, s.Name, s.Owner, s.Query, s.Regex, s.App, s.Log, s.Level, s.From, s.To, s.CreatedAt, s.UpdatedAt)
+	return err
+}
+
+func UpdateSavedSearch(s SavedSearch) error {
+	if DB == nil {
+		return fmt.Errorf("database not initialized")
+	}
+	_, err := DB.Exec(`UPDATE saved_searches SET name=?, query=?, regex=?, app=?, log=?, level=?,
+						 time_from=?, time_to=?, updated_at=? WHERE id=?`,
+		s.Name, s.Query, s.Regex, s.App, s.Log, s.Level, s.From, s.To, s.UpdatedAt, s.ID)
+	return err
+}
+
+func DeleteSavedSearch(id string) error {
+	if DB == nil {
+		return fmt.Errorf("database not initialized")
+	}
+	_, err := DB.Exec("DELETE FROM saved_searches WHERE id=?", id)
+	return err
+}
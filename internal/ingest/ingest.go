@@ -0,0 +1,229 @@
+// Package ingest accepts log events pushed over HTTP by applications whose
+// files logmojo cannot read, and stores them as JSON lines in rotating files
+// that are searched like any other log source.
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"logmojo/internal/config"
+	"logmojo/internal/logs"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultLogName = "Ingest"
+	// Upper bound on a decompressed request body
+	maxBodySize = 32 * 1024 * 1024
+)
+
+// source is where the events of one token go
+type source struct {
+	token string
+	app   string
+	log   string
+	path  string
+}
+
+var (
+	sources   []source
+	files     *logs.RotatingFiles
+	ingestDir string
+)
+
+// Init registers a log for every configured ingest source and for the
+// OpenTelemetry services seen before
+func Init(cfg config.IngestConfig) error {
+	dir, err := filepath.Abs(cfg.Dir)
+	if err != nil {
+		return err
+	}
+	ingestDir = dir
+	files = logs.NewRotatingFiles(int64(cfg.MaxFileSize)*1024*1024, cfg.MaxFiles)
+	if err := initOTLP(cfg.OTLP, dir); err != nil {
+		return err
+	}
+
+	registered := make(map[string]bool)
+	seen := make(map[string]bool)
+	for _, s := range cfg.Sources {
+		if s.App == "" || s.Token == "" {
+			return fmt.Errorf("ingest: every source needs an app and a token")
+		}
+		if seen[s.Token] {
+			return fmt.Errorf("ingest: token of %s is used twice", s.App)
+		}
+		seen[s.Token] = true
+		if s.Log == "" {
+			s.Log = defaultLogName
+		}
+
+		path := filepath.Join(dir, logs.SafeFileName(s.App), logs.SafeFileName(s.Log)+".log")
+		sources = append(sources, source{token: s.Token, app: s.App, log: s.Log, path: path})
+		// Several tokens may feed the same log
+		if !registered[path] {
+			registered[path] = true
+			config.RegisterLogs(s.App, config.LogConfig{Name: s.Log, Path: path, Format: "json", Unordered: true})
+		}
+	}
+
+	if len(sources) > 0 {
+		log.Printf("[INGEST] %d ingest sources configured", len(sources))
+	}
+	return nil
+}
+
+// findSource returns the source of a token, comparing in constant time
+func findSource(token string) (source, bool) {
+	for _, s := range sources {
+		if subtle.ConstantTimeCompare([]byte(s.token), []byte(token)) == 1 {
+			return s, true
+		}
+	}
+	return source{}, false
+}
+
+// Handler is POST /api/ingest. The token goes in "Authorization: Bearer" or
+// X-Ingest-Token. The body is NDJSON, a JSON array of events or plain text
+// (one event per line), optionally gzip-compressed.
+func Handler(c *fiber.Ctx) error {
+	token := strings.TrimSpace(strings.TrimPrefix(c.Get("Authorization"), "Bearer "))
+	if token == "" {
+		token = c.Get("X-Ingest-Token")
+	}
+	src, ok := findSource(token)
+	if token == "" || !ok {
+		return c.Status(401).JSON(fiber.Map{"error": "Invalid ingest token"})
+	}
+
+	body, status, err := readBody(c)
+	if err != nil {
+		return c.Status(status).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	lines, err := encode(body, c.Get("Content-Type"), time.Now())
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if len(lines) > 0 {
+		if err := files.Write(src.path, bytes.Join(lines, nil)); err != nil {
+			log.Printf("[INGEST] Failed to write %s: %v", src.path, err)
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to store events"})
+		}
+	}
+	return c.JSON(fiber.Map{"accepted": len(lines), "app": src.app, "log": src.log})
+}
+
+// readBody returns the request body, inflating gzip up to maxBodySize. On
+// failure it also returns the status to answer with.
+func readBody(c *fiber.Ctx) ([]byte, int, error) {
+	// The raw body: c.Body() would inflate gzip without a size limit
+	body := c.Request().Body()
+	if !strings.EqualFold(c.Get("Content-Encoding"), "gzip") {
+		return body, 200, nil
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, 400, fmt.Errorf("invalid gzip body")
+	}
+	body, err = io.ReadAll(io.LimitReader(zr, maxBodySize+1))
+	if err != nil {
+		return nil, 400, fmt.Errorf("invalid gzip body")
+	}
+	if len(body) > maxBodySize {
+		return nil, 413, fmt.Errorf("body too large")
+	}
+	return body, 200, nil
+}
+
+// encode turns a request body into stored lines. JSON events keep their
+// keys; events without a timestamp key and plain text lines get the time
+// they were received.
+func encode(body []byte, contentType string, received time.Time) ([][]byte, error) {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 {
+		return nil, nil
+	}
+
+	isText := strings.HasPrefix(contentType, "text/plain")
+	if !isText && (trimmed[0] == '[' || trimmed[0] == '{') {
+		return encodeJSON(trimmed, received)
+	}
+
+	var lines [][]byte
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		text := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		line, err := json.Marshal(map[string]string{"time": received.Format(time.RFC3339Nano), "msg": text})
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, append(line, '\n'))
+	}
+	return lines, scanner.Err()
+}
+
+// encodeJSON reads a JSON array of events, or a stream of events as in NDJSON
+func encodeJSON(body []byte, received time.Time) ([][]byte, error) {
+	var events []json.RawMessage
+	if body[0] == '[' {
+		if err := json.Unmarshal(body, &events); err != nil {
+			return nil, fmt.Errorf("invalid JSON array: %v", err)
+		}
+	} else {
+		dec := json.NewDecoder(bytes.NewReader(body))
+		for n := 1; ; n++ {
+			var ev json.RawMessage
+			if err := dec.Decode(&ev); err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, fmt.Errorf("invalid JSON in event %d: %v", n, err)
+			}
+			events = append(events, ev)
+		}
+	}
+
+	lines := make([][]byte, 0, len(events))
+	for i, ev := range events {
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(ev, &obj); err != nil {
+			// A bare string or number is the message
+			obj = map[string]json.RawMessage{"msg": ev}
+		}
+		if obj == nil {
+			return nil, fmt.Errorf("event %d is null", i+1)
+		}
+
+		hasTime := false
+		for key := range obj {
+			if logs.IsTimestampKey(key) {
+				hasTime = true
+				break
+			}
+		}
+		if !hasTime {
+			obj["time"], _ = json.Marshal(received.Format(time.RFC3339Nano))
+		}
+
+		line, err := json.Marshal(obj)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, append(line, '\n'))
+	}
+	return lines, nil
+}
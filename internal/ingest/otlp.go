@@ -0,0 +1,262 @@
+package ingest
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"logmojo/internal/config"
+	"logmojo/internal/logs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Log name of OpenTelemetry records, their file in each service's directory,
+// and the directory under the ingest dir holding the services, apart from
+// ingest sources
+const (
+	otlpLogName = "OpenTelemetry"
+	otlpFile    = otlpLogName + ".log"
+	otlpSubdir  = "otlp"
+)
+
+var (
+	otlp config.OTLPConfig
+	// Services with a log entry of their own
+	services = struct {
+		sync.Mutex
+		registered map[string]bool
+	}{registered: make(map[string]bool)}
+)
+
+// initOTLP registers the logs of OpenTelemetry services seen before: each
+// service's records under the app of the same name, and all of them under
+// the configured app. The receiver writes to disk without a login, so it
+// refuses to start without a token.
+func initOTLP(cfg config.OTLPConfig, dir string) error {
+	otlp = cfg
+	if !cfg.Enabled {
+		return nil
+	}
+	if cfg.Token == "" {
+		return fmt.Errorf("ingest: otlp needs a token")
+	}
+
+	// Only files one level down, in a service's directory
+	dir = filepath.Join(dir, otlpSubdir)
+	config.RegisterLogs(cfg.App, config.LogConfig{
+		Name: "All services", Path: dir, Recursive: true, Include: []string{"*/" + otlpFile + "*"}, Format: "json", Unordered: true,
+	})
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name(), otlpFile)
+		if service := serviceOf(path); e.IsDir() && service != "" {
+			registerService(service, path)
+		}
+	}
+	log.Printf("[INGEST] OTLP logs receiver enabled on /v1/logs")
+	return nil
+}
+
+// registerService adds the log of a service under the app of the same name,
+// once, when it is found at startup or first sends
+func registerService(service, path string) {
+	services.Lock()
+	defer services.Unlock()
+	if services.registered[service] {
+		return
+	}
+	services.registered[service] = true
+	config.RegisterLogs(service, config.LogConfig{Name: otlpLogName, Path: path, Format: "json", Unordered: true})
+}
+
+// serviceDir returns the directory of a service's records. Sanitizing alone
+// would give "a/b" and "a_b" the same directory, so a hash of the name
+// tells them apart.
+func serviceDir(service string) string {
+	sum := sha256.Sum256([]byte(service))
+	return filepath.Join(ingestDir, otlpSubdir, logs.SafeFileName(service)+"-"+hex.EncodeToString(sum[:4]))
+}
+
+// serviceOf reads the service name from the first record of a file, as
+// directory names are sanitized
+func serviceOf(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	if !scanner.Scan() {
+		return ""
+	}
+	var rec struct {
+		Service string `json:"service.name"`
+	}
+	json.Unmarshal(scanner.Bytes(), &rec)
+	return rec.Service
+}
+
+// OTLPHandler is POST /v1/logs, the OTLP/HTTP logs endpoint. It accepts
+// ExportLogsServiceRequest as protobuf or JSON, optionally gzip-compressed.
+func OTLPHandler(c *fiber.Ctx) error {
+	if !otlp.Enabled {
+		return c.Status(404).JSON(fiber.Map{"error": "OTLP receiver is disabled"})
+	}
+	token := strings.TrimPrefix(c.Get("Authorization"), "Bearer ")
+	if otlp.Token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(otlp.Token)) != 1 {
+		return c.Status(401).JSON(fiber.Map{"error": "Invalid token"})
+	}
+
+	body, status, err := readBody(c)
+	if err != nil {
+		return c.Status(status).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	isJSON := strings.HasPrefix(c.Get("Content-Type"), "application/json")
+	var req logsRequest
+	if isJSON {
+		err = json.Unmarshal(body, &req)
+	} else {
+		req, err = decodeLogsRequest(body)
+	}
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid OTLP request: " + err.Error()})
+	}
+
+	if err := storeOTLP(req, time.Now()); err != nil {
+		log.Printf("[INGEST] Failed to store OTLP logs: %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to store logs"})
+	}
+
+	// An empty ExportLogsServiceResponse means everything was accepted
+	if isJSON {
+		return c.JSON(fiber.Map{})
+	}
+	c.Set("Content-Type", "application/x-protobuf")
+	return c.Send(nil)
+}
+
+// storeOTLP writes the records of each service to its file, one JSON line
+// per record
+func storeOTLP(req logsRequest, received time.Time) error {
+	for _, rl := range req.ResourceLogs {
+		resourceAttrs := attributeMap(rl.Resource.Attributes)
+		service, _ := resourceAttrs["service.name"].(string)
+		if service == "" {
+			service = "unknown_service"
+		}
+		delete(resourceAttrs, "service.name")
+
+		var lines []byte
+		for _, sl := range rl.ScopeLogs {
+			for _, rec := range sl.LogRecords {
+				line, err := json.Marshal(otlpRecord(rec, sl.Scope, service, resourceAttrs, received))
+				if err != nil {
+					return err
+				}
+				lines = append(append(lines, line...), '\n')
+			}
+		}
+		if len(lines) == 0 {
+			continue
+		}
+		path := filepath.Join(serviceDir(service), otlpFile)
+		if err := files.Write(path, lines); err != nil {
+			return err
+		}
+		registerService(service, path)
+	}
+	return nil
+}
+
+// otlpRecord flattens a log record for storage. Record attributes become
+// top-level fields; resource attributes are kept under "resource.".
+func otlpRecord(rec logRecord, sc scope, service string, resourceAttrs map[string]interface{}, received time.Time) map[string]interface{} {
+	out := make(map[string]interface{}, len(rec.Attributes)+8)
+	for _, kv := range rec.Attributes {
+		key := kv.Key
+		// Keep attributes named like level, time or msg from posing as them
+		if logs.IsReservedKey(key) || key == "service.name" {
+			key = "attributes." + key
+		}
+		out[key] = kv.Value.value()
+	}
+	if len(resourceAttrs) > 0 {
+		out["resource"] = resourceAttrs
+	}
+
+	ts := time.Unix(0, int64(rec.TimeUnixNano))
+	if rec.TimeUnixNano == 0 {
+		ts = time.Unix(0, int64(rec.ObservedTimeUnixNano))
+		if rec.ObservedTimeUnixNano == 0 {
+			ts = received
+		}
+	}
+	out["time"] = ts.UTC().Format(time.RFC3339Nano)
+	out["service.name"] = service
+
+	if level := severityLevel(rec.SeverityNumber); level != "" {
+		out["level"] = level
+	} else if rec.SeverityText != "" {
+		out["level"] = rec.SeverityText
+	}
+	if rec.SeverityText != "" {
+		out["severity_text"] = rec.SeverityText
+	}
+
+	switch body := rec.Body.value().(type) {
+	case nil:
+		out["msg"] = rec.EventName
+	case string:
+		out["msg"] = body
+	default:
+		// Structured bodies are searchable as body.* fields
+		out["body"] = body
+		encoded, _ := json.Marshal(body)
+		out["msg"] = string(encoded)
+	}
+
+	if sc.Name != "" {
+		out["scope"] = sc.Name
+	}
+	if rec.EventName != "" {
+		out["event_name"] = rec.EventName
+	}
+	if rec.TraceID != "" {
+		out["trace_id"] = rec.TraceID
+	}
+	if rec.SpanID != "" {
+		out["span_id"] = rec.SpanID
+	}
+	return out
+}
+
+// severityLevel maps OTLP severity numbers (1-24, four per level) to levels
+func severityLevel(n int) string {
+	switch {
+	case n >= 1 && n <= 4:
+		return "TRACE"
+	case n >= 5 && n <= 8:
+		return "DEBUG"
+	case n >= 9 && n <= 12:
+		return "INFO"
+	case n >= 13 && n <= 16:
+		return "WARN"
+	case n >= 17 && n <= 20:
+		return "ERROR"
+	case n >= 21 && n <= 24:
+		return "FATAL"
+	}
+	return ""
+}
@@ -0,0 +1,436 @@
+package ingest
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// OTLP logs messages, with the field names of OTLP/JSON. The protobuf
+// decoders below fill the same structs from the binary encoding, so the
+// opentelemetry-proto module is not needed for the few messages used here.
+
+type logsRequest struct {
+	ResourceLogs []resourceLogs `json:"resourceLogs"`
+}
+
+type resourceLogs struct {
+	Resource  resource    `json:"resource"`
+	ScopeLogs []scopeLogs `json:"scopeLogs"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes"`
+}
+
+type scopeLogs struct {
+	Scope      scope       `json:"scope"`
+	LogRecords []logRecord `json:"logRecords"`
+}
+
+type scope struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type logRecord struct {
+	TimeUnixNano         jsonUint64 `json:"timeUnixNano"`
+	ObservedTimeUnixNano jsonUint64 `json:"observedTimeUnixNano"`
+	SeverityNumber       int        `json:"severityNumber"`
+	SeverityText         string     `json:"severityText"`
+	Body                 anyValue   `json:"body"`
+	Attributes           []keyValue `json:"attributes"`
+	TraceID              string     `json:"traceId"` // Hex
+	SpanID               string     `json:"spanId"`  // Hex
+	EventName            string     `json:"eventName"`
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+type anyValue struct {
+	StringValue *string     `json:"stringValue"`
+	BoolValue   *bool       `json:"boolValue"`
+	IntValue    *jsonInt64  `json:"intValue"`
+	DoubleValue *float64    `json:"doubleValue"`
+	ArrayValue  *arrayValue `json:"arrayValue"`
+	KvlistValue *kvlist     `json:"kvlistValue"`
+	BytesValue  []byte      `json:"bytesValue"` // Base64 in JSON
+}
+
+type arrayValue struct {
+	Values []anyValue `json:"values"`
+}
+
+type kvlist struct {
+	Values []keyValue `json:"values"`
+}
+
+// value converts an AnyValue to a plain Go value, or nil when it is empty
+func (v anyValue) value() interface{} {
+	switch {
+	case v.StringValue != nil:
+		return *v.StringValue
+	case v.BoolValue != nil:
+		return *v.BoolValue
+	case v.IntValue != nil:
+		return int64(*v.IntValue)
+	case v.DoubleValue != nil:
+		return *v.DoubleValue
+	case v.ArrayValue != nil:
+		values := make([]interface{}, 0, len(v.ArrayValue.Values))
+		for _, item := range v.ArrayValue.Values {
+			values = append(values, item.value())
+		}
+		return values
+	case v.KvlistValue != nil:
+		return attributeMap(v.KvlistValue.Values)
+	case v.BytesValue != nil:
+		return v.BytesValue
+	}
+	return nil
+}
+
+func attributeMap(kvs []keyValue) map[string]interface{} {
+	m := make(map[string]interface{}, len(kvs))
+	for _, kv := range kvs {
+		m[kv.Key] = kv.Value.value()
+	}
+	return m
+}
+
+// OTLP/JSON writes 64-bit integers as strings, but numbers are accepted too
+type jsonUint64 uint64
+
+func (n *jsonUint64) UnmarshalJSON(data []byte) error {
+	v, err := strconv.ParseUint(unquote(data), 10, 64)
+	*n = jsonUint64(v)
+	return err
+}
+
+type jsonInt64 int64
+
+func (n *jsonInt64) UnmarshalJSON(data []byte) error {
+	v, err := strconv.ParseInt(unquote(data), 10, 64)
+	*n = jsonInt64(v)
+	return err
+}
+
+func unquote(data []byte) string {
+	s := string(data)
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// Protobuf wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+var errTruncated = errors.New("truncated protobuf message")
+
+// Nesting allowed in attribute values, so a hostile body cannot exhaust the stack
+const maxValueDepth = 32
+
+// protoReader walks the fields of one protobuf message
+type protoReader struct {
+	b []byte
+}
+
+// next returns the next field number and wire type, or ok=false at the end
+func (r *protoReader) next() (field, wire int, ok bool, err error) {
+	if len(r.b) == 0 {
+		return 0, 0, false, nil
+	}
+	key, err := r.varint()
+	if err != nil {
+		return 0, 0, false, err
+	}
+	return int(key >> 3), int(key & 7), true, nil
+}
+
+func (r *protoReader) varint() (uint64, error) {
+	v, n := binary.Uvarint(r.b)
+	if n <= 0 {
+		return 0, errTruncated
+	}
+	r.b = r.b[n:]
+	return v, nil
+}
+
+func (r *protoReader) fixed64() (uint64, error) {
+	if len(r.b) < 8 {
+		return 0, errTruncated
+	}
+	v := binary.LittleEndian.Uint64(r.b)
+	r.b = r.b[8:]
+	return v, nil
+}
+
+func (r *protoReader) bytes() ([]byte, error) {
+	n, err := r.varint()
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(len(r.b)) {
+		return nil, errTruncated
+	}
+	v := r.b[:n]
+	r.b = r.b[n:]
+	return v, nil
+}
+
+func (r *protoReader) skip(wire int) error {
+	var err error
+	switch wire {
+	case wireVarint:
+		_, err = r.varint()
+	case wireFixed64:
+		_, err = r.fixed64()
+	case wireBytes:
+		_, err = r.bytes()
+	case wireFixed32:
+		if len(r.b) < 4 {
+			return errTruncated
+		}
+		r.b = r.b[4:]
+	default:
+		return fmt.Errorf("unsupported protobuf wire type %d", wire)
+	}
+	return err
+}
+
+// fields calls fn for every field of a message. fn reads the value of the
+// fields it knows and returns handled=false for the others, which are skipped.
+func fields(data []byte, fn func(r *protoReader, field, wire int) (handled bool, err error)) error {
+	r := &protoReader{b: data}
+	for {
+		field, wire, ok, err := r.next()
+		if err != nil || !ok {
+			return err
+		}
+		handled, err := fn(r, field, wire)
+		if err != nil {
+			return err
+		}
+		if !handled {
+			if err := r.skip(wire); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// message reads a length-delimited field and decodes it with decode
+func message(r *protoReader, wire int, decode func([]byte) error) (bool, error) {
+	if wire != wireBytes {
+		return false, nil
+	}
+	b, err := r.bytes()
+	if err != nil {
+		return true, err
+	}
+	return true, decode(b)
+}
+
+func decodeLogsRequest(data []byte) (logsRequest, error) {
+	var req logsRequest
+	err := fields(data, func(r *protoReader, field, wire int) (bool, error) {
+		if field != 1 {
+			return false, nil
+		}
+		return message(r, wire, func(b []byte) error {
+			rl, err := decodeResourceLogs(b)
+			req.ResourceLogs = append(req.ResourceLogs, rl)
+			return err
+		})
+	})
+	return req, err
+}
+
+func decodeResourceLogs(data []byte) (resourceLogs, error) {
+	var rl resourceLogs
+	err := fields(data, func(r *protoReader, field, wire int) (bool, error) {
+		switch field {
+		case 1: // Resource
+			return message(r, wire, func(b []byte) error {
+				return fields(b, func(r *protoReader, field, wire int) (bool, error) {
+					if field != 1 {
+						return false, nil
+					}
+					return message(r, wire, func(b []byte) error {
+						kv, err := decodeKeyValue(b, 0)
+						rl.Resource.Attributes = append(rl.Resource.Attributes, kv)
+						return err
+					})
+				})
+			})
+		case 2: // ScopeLogs
+			return message(r, wire, func(b []byte) error {
+				sl, err := decodeScopeLogs(b)
+				rl.ScopeLogs = append(rl.ScopeLogs, sl)
+				return err
+			})
+		}
+		return false, nil
+	})
+	return rl, err
+}
+
+func decodeScopeLogs(data []byte) (scopeLogs, error) {
+	var sl scopeLogs
+	err := fields(data, func(r *protoReader, field, wire int) (bool, error) {
+		switch field {
+		case 1: // InstrumentationScope
+			return message(r, wire, func(b []byte) error {
+				return fields(b, func(r *protoReader, field, wire int) (bool, error) {
+					switch field {
+					case 1:
+						return message(r, wire, func(b []byte) error { sl.Scope.Name = string(b); return nil })
+					case 2:
+						return message(r, wire, func(b []byte) error { sl.Scope.Version = string(b); return nil })
+					}
+					return false, nil
+				})
+			})
+		case 2: // LogRecord
+			return message(r, wire, func(b []byte) error {
+				rec, err := decodeLogRecord(b)
+				sl.LogRecords = append(sl.LogRecords, rec)
+				return err
+			})
+		}
+		return false, nil
+	})
+	return sl, err
+}
+
+func decodeLogRecord(data []byte) (logRecord, error) {
+	var rec logRecord
+	err := fields(data, func(r *protoReader, field, wire int) (bool, error) {
+		switch {
+		case (field == 1 || field == 11) && wire == wireFixed64:
+			v, err := r.fixed64()
+			if field == 1 {
+				rec.TimeUnixNano = jsonUint64(v)
+			} else {
+				rec.ObservedTimeUnixNano = jsonUint64(v)
+			}
+			return true, err
+		case field == 2 && wire == wireVarint:
+			v, err := r.varint()
+			rec.SeverityNumber = int(v)
+			return true, err
+		case field == 3:
+			return message(r, wire, func(b []byte) error { rec.SeverityText = string(b); return nil })
+		case field == 5:
+			return message(r, wire, func(b []byte) error {
+				var err error
+				rec.Body, err = decodeAnyValue(b, 0)
+				return err
+			})
+		case field == 6:
+			return message(r, wire, func(b []byte) error {
+				kv, err := decodeKeyValue(b, 0)
+				rec.Attributes = append(rec.Attributes, kv)
+				return err
+			})
+		case field == 9:
+			return message(r, wire, func(b []byte) error { rec.TraceID = hex.EncodeToString(b); return nil })
+		case field == 10:
+			return message(r, wire, func(b []byte) error { rec.SpanID = hex.EncodeToString(b); return nil })
+		case field == 12:
+			return message(r, wire, func(b []byte) error { rec.EventName = string(b); return nil })
+		}
+		return false, nil
+	})
+	return rec, err
+}
+
+func decodeKeyValue(data []byte, depth int) (keyValue, error) {
+	var kv keyValue
+	err := fields(data, func(r *protoReader, field, wire int) (bool, error) {
+		switch field {
+		case 1:
+			return message(r, wire, func(b []byte) error { kv.Key = string(b); return nil })
+		case 2:
+			return message(r, wire, func(b []byte) error {
+				var err error
+				kv.Value, err = decodeAnyValue(b, depth)
+				return err
+			})
+		}
+		return false, nil
+	})
+	return kv, err
+}
+
+func decodeAnyValue(data []byte, depth int) (anyValue, error) {
+	var v anyValue
+	if depth > maxValueDepth {
+		return v, errors.New("attribute values nested too deeply")
+	}
+	err := fields(data, func(r *protoReader, field, wire int) (bool, error) {
+		switch {
+		case field == 1:
+			return message(r, wire, func(b []byte) error { s := string(b); v.StringValue = &s; return nil })
+		case field == 2 && wire == wireVarint:
+			n, err := r.varint()
+			b := n != 0
+			v.BoolValue = &b
+			return true, err
+		case field == 3 && wire == wireVarint:
+			n, err := r.varint()
+			i := jsonInt64(int64(n))
+			v.IntValue = &i
+			return true, err
+		case field == 4 && wire == wireFixed64:
+			n, err := r.fixed64()
+			f := math.Float64frombits(n)
+			v.DoubleValue = &f
+			return true, err
+		case field == 5:
+			return message(r, wire, func(b []byte) error {
+				v.ArrayValue = &arrayValue{}
+				return fields(b, func(r *protoReader, field, wire int) (bool, error) {
+					if field != 1 {
+						return false, nil
+					}
+					return message(r, wire, func(b []byte) error {
+						item, err := decodeAnyValue(b, depth+1)
+						v.ArrayValue.Values = append(v.ArrayValue.Values, item)
+						return err
+					})
+				})
+			})
+		case field == 6:
+			return message(r, wire, func(b []byte) error {
+				v.KvlistValue = &kvlist{}
+				return fields(b, func(r *protoReader, field, wire int) (bool, error) {
+					if field != 1 {
+						return false, nil
+					}
+					return message(r, wire, func(b []byte) error {
+						kv, err := decodeKeyValue(b, depth+1)
+						v.KvlistValue.Values = append(v.KvlistValue.Values, kv)
+						return err
+					})
+				})
+			})
+		case field == 7:
+			return message(r, wire, func(b []byte) error { v.BytesValue = append([]byte{}, b...); return nil })
+		}
+		return false, nil
+	})
+	return v, err
+}
@@ -0,0 +1,174 @@
+package ingest
+
+import (
+	"encoding/binary"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// Protobuf encoding helpers: each returns one field with its key
+func pbKey(field, wire int) []byte {
+	return binary.AppendUvarint(nil, uint64(field<<3|wire))
+}
+
+func pbVarint(field int, v uint64) []byte {
+	return binary.AppendUvarint(pbKey(field, wireVarint), v)
+}
+
+func pbFixed64(field int, v uint64) []byte {
+	return binary.LittleEndian.AppendUint64(pbKey(field, wireFixed64), v)
+}
+
+func pbBytes(field int, parts ...[]byte) []byte {
+	var payload []byte
+	for _, p := range parts {
+		payload = append(payload, p...)
+	}
+	b := binary.AppendUvarint(pbKey(field, wireBytes), uint64(len(payload)))
+	return append(b, payload...)
+}
+
+func pbString(field int, s string) []byte {
+	return pbBytes(field, []byte(s))
+}
+
+// pbAttr encodes a KeyValue with a string value
+func pbAttr(field int, key, value string) []byte {
+	return pbBytes(field, pbString(1, key), pbBytes(2, pbString(1, value)))
+}
+
+func TestDecodeLogsRequest(t *testing.T) {
+	record := pbBytes(2,
+		pbFixed64(1, 1705312800000000000),
+		pbFixed64(11, 1705312801000000000),
+		pbVarint(2, 17),
+		pbString(3, "ERROR"),
+		pbBytes(5, pbString(1, "payment declined")),
+		pbAttr(6, "order.id", "A-17"),
+		pbBytes(6, pbString(1, "retries"), pbBytes(2, pbVarint(3, 3))),
+		pbBytes(9, []byte{0x5b, 0x8e, 0xff, 0xf7, 0x98, 0x03, 0x81, 0x03, 0xd2, 0x69, 0xb6, 0x33, 0x81, 0x3f, 0xc6, 0x0c}),
+		pbBytes(10, []byte{0xee, 0xe1, 0x9b, 0x7e, 0xc3, 0xc1, 0xb1, 0x74}),
+		pbString(12, "payment.failed"),
+		pbVarint(99, 1), // Unknown fields are skipped
+		pbBytes(98, []byte("ignored")),
+	)
+	data := pbBytes(1,
+		pbBytes(1, pbAttr(1, "service.name", "checkout")),
+		pbBytes(2, pbBytes(1, pbString(1, "io.shop"), pbString(2, "1.2.0")), record),
+	)
+
+	req, err := decodeLogsRequest(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	str := func(s string) *string { return &s }
+	retries := jsonInt64(3)
+	want := logsRequest{ResourceLogs: []resourceLogs{{
+		Resource: resource{Attributes: []keyValue{{Key: "service.name", Value: anyValue{StringValue: str("checkout")}}}},
+		ScopeLogs: []scopeLogs{{
+			Scope: scope{Name: "io.shop", Version: "1.2.0"},
+			LogRecords: []logRecord{{
+				TimeUnixNano:         1705312800000000000,
+				ObservedTimeUnixNano: 1705312801000000000,
+				SeverityNumber:       17,
+				SeverityText:         "ERROR",
+				Body:                 anyValue{StringValue: str("payment declined")},
+				Attributes: []keyValue{
+					{Key: "order.id", Value: anyValue{StringValue: str("A-17")}},
+					{Key: "retries", Value: anyValue{IntValue: &retries}},
+				},
+				TraceID:   "5b8efff798038103d269b633813fc60c",
+				SpanID:    "eee19b7ec3c1b174",
+				EventName: "payment.failed",
+			}},
+		}},
+	}}}
+	if !reflect.DeepEqual(req, want) {
+		t.Errorf("got %+v\nwant %+v", req, want)
+	}
+}
+
+func TestDecodeAnyValue(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want interface{}
+	}{
+		{"string", pbString(1, "text"), "text"},
+		{"bool", pbVarint(2, 1), true},
+		{"int", pbVarint(3, 42), int64(42)},
+		{"negative int", pbVarint(3, math.MaxUint64), int64(-1)},
+		{"double", pbFixed64(4, math.Float64bits(1.5)), 1.5},
+		{"bytes", pbBytes(7, []byte{1, 2}), []byte{1, 2}},
+		{"array", pbBytes(5, pbBytes(1, pbString(1, "a")), pbBytes(1, pbVarint(3, 2))), []interface{}{"a", int64(2)}},
+		{"kvlist", pbBytes(6, pbAttr(1, "k", "v")), map[string]interface{}{"k": "v"}},
+		{"empty", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := decodeAnyValue(tt.data, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := v.value(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeLogsRequestErrors(t *testing.T) {
+	// Arrays nested one level deeper than allowed
+	nested := pbString(1, "deep")
+	for i := 0; i <= maxValueDepth+1; i++ {
+		nested = pbBytes(5, pbBytes(1, nested))
+	}
+	body := pbBytes(1, pbBytes(2, pbBytes(2, pbBytes(5, nested))))
+
+	valid := pbBytes(1, pbBytes(2, pbBytes(2, pbVarint(2, 9))))
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"truncated key", []byte{0x80}},
+		{"truncated length", valid[:1]},
+		{"truncated message", valid[:len(valid)-1]},
+		{"length past the end", append(pbKey(1, wireBytes), 0x7f)},
+		{"truncated fixed64", pbFixed64(7, 1)[:5]},
+		{"truncated fixed32", append(pbKey(7, wireFixed32), 1, 2)},
+		{"unsupported wire type", pbKey(7, 3)},
+		{"nested too deeply", body},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if req, err := decodeLogsRequest(tt.data); err == nil {
+				t.Errorf("decoded %+v, want an error", req)
+			}
+		})
+	}
+
+	// The same nesting within the limit decodes
+	nested = pbString(1, "deep")
+	for i := 0; i < maxValueDepth; i++ {
+		nested = pbBytes(5, pbBytes(1, nested))
+	}
+	if _, err := decodeLogsRequest(pbBytes(1, pbBytes(2, pbBytes(2, pbBytes(5, nested))))); err != nil {
+		t.Errorf("nesting within the limit: %v", err)
+	}
+}
+
+func TestSeverityLevel(t *testing.T) {
+	tests := []struct {
+		n    int
+		want string
+	}{
+		{0, ""}, {1, "TRACE"}, {4, "TRACE"}, {5, "DEBUG"}, {9, "INFO"}, {12, "INFO"},
+		{13, "WARN"}, {17, "ERROR"}, {20, "ERROR"}, {21, "FATAL"}, {24, "FATAL"}, {25, ""},
+	}
+	for _, tt := range tests {
+		if got := severityLevel(tt.n); got != tt.want {
+			t.Errorf("severityLevel(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
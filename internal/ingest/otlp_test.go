@@ -0,0 +1,129 @@
+package ingest
+
+import (
+	"encoding/json"
+	"fmt"
+	"logmojo/internal/config"
+	"logmojo/internal/logs"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// useOTLP starts the receiver, and any ingest sources, with an empty config
+// and a fresh directory
+func useOTLP(t *testing.T, token string, extra ...config.IngestSource) error {
+	t.Helper()
+	saved := config.AppConfigData
+	t.Cleanup(func() {
+		config.AppConfigData = saved
+		otlp = config.OTLPConfig{}
+		services.registered = make(map[string]bool)
+		sources = nil
+	})
+	config.AppConfigData = config.Config{}
+	return Init(config.IngestConfig{
+		Dir: t.TempDir(), MaxFileSize: 1, MaxFiles: 1, Sources: extra,
+		OTLP: config.OTLPConfig{Enabled: true, Token: token, App: "OpenTelemetry"},
+	})
+}
+
+func TestOTLPRequiresToken(t *testing.T) {
+	if err := useOTLP(t, ""); err == nil {
+		t.Fatal("receiver started without a token")
+	}
+}
+
+func TestOTLPRegistersNewServices(t *testing.T) {
+	if err := useOTLP(t, "secret"); err != nil {
+		t.Fatal(err)
+	}
+	app := fiber.New()
+	app.Post("/v1/logs", OTLPHandler)
+
+	body := `{"resourceLogs":[{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"checkout"}}]},
+		"scopeLogs":[{"logRecords":[{"timeUnixNano":"1705312800000000000","severityNumber":17,"body":{"stringValue":"payment declined"}}]}]}]}`
+	post := func(auth string) int {
+		req := httptest.NewRequest("POST", "/v1/logs", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+
+	for _, auth := range []string{"", "Bearer wrong"} {
+		if status := post(auth); status != 401 {
+			t.Errorf("Authorization %q: status %d, want 401", auth, status)
+		}
+	}
+	if len(config.Apps()) != 1 {
+		t.Fatalf("rejected request registered a service: %+v", config.Apps())
+	}
+
+	for i := 0; i < 2; i++ {
+		if status := post("Bearer secret"); status != 200 {
+			t.Fatalf("status %d, want 200", status)
+		}
+	}
+	apps := config.Apps()
+	if len(apps) != 2 || apps[1].Name != "checkout" || len(apps[1].Logs) != 1 || apps[1].Logs[0].Name != otlpLogName {
+		t.Errorf("unexpected apps %+v", apps)
+	}
+}
+
+func TestOTLPServicesKeepTheirOwnFiles(t *testing.T) {
+	// An ingest source with the app and log name of a service's records
+	if err := useOTLP(t, "secret", config.IngestSource{App: "checkout", Log: otlpLogName, Token: "t"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var resources []string
+	for _, service := range []string{"a/b", "a_b", "checkout"} {
+		resources = append(resources, fmt.Sprintf(`{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":%q}}]},
+			"scopeLogs":[{"logRecords":[{"body":{"stringValue":"from %s"}}]}]}`, service, service))
+	}
+	var req logsRequest
+	if err := json.Unmarshal([]byte(`{"resourceLogs":[`+strings.Join(resources, ",")+`]}`), &req); err != nil {
+		t.Fatal(err)
+	}
+	if err := storeOTLP(req, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	paths := make(map[string]string)
+	for _, app := range config.Apps() {
+		for _, l := range app.Logs {
+			if l.Name == otlpLogName && filepath.Base(filepath.Dir(filepath.Dir(l.Path))) == otlpSubdir {
+				paths[app.Name] = l.Path
+			}
+		}
+	}
+	for _, service := range []string{"a/b", "a_b", "checkout"} {
+		data, err := os.ReadFile(paths[service])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := strings.Count(string(data), "\n"); n != 1 || !strings.Contains(string(data), "from "+service) {
+			t.Errorf("%s: file %s holds %q", service, paths[service], data)
+		}
+	}
+	if paths["checkout"] == sources[0].path {
+		t.Errorf("service and ingest source share %s", sources[0].path)
+	}
+	if err := files.Write(sources[0].path, []byte("{}\n")); err != nil {
+		t.Fatal(err)
+	}
+	if files, err := logs.ListFiles("OpenTelemetry", "All services"); err != nil || len(files) != 3 {
+		t.Errorf("All services lists %+v, %v; want the 3 service files", files, err)
+	}
+}
@@ -0,0 +1,132 @@
+package logs
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const maxContextLines = 500
+
+// errJournalContext is returned for journal sources: their line numbers
+// count from the start of a search's time window, which a context request
+// does not carry
+var errJournalContext = errors.New("context is not available for journal sources, search around the entry's time instead")
+
+// ContextOptions selects the lines around a search hit. The hit is given by
+// its 1-based Line number or, if Line is 0, by its byte Offset.
+type ContextOptions struct {
+	Line   int
+	Offset int64
+	Before int
+	After  int
+	Apps   []string // Apps the file belongs to, whose redaction rules apply
+}
+
+// ContextLine is one raw line of a log file
+type ContextLine struct {
+	Line   int    `json:"line"`
+	Offset int64  `json:"offset"`
+	Text   string `json:"text"`
+	Match  bool   `json:"match"` // The line that was asked for
+}
+
+// ContextResult holds the lines around a hit, oldest first
+type ContextResult struct {
+	File          string        `json:"file"`
+	Lines         []ContextLine `json:"lines"`
+	HasMoreBefore bool          `json:"has_more_before"`
+	HasMoreAfter  bool          `json:"has_more_after"`
+}
+
+// Context returns the lines before and after a hit in a plain or compressed
+// file. Line numbers and offsets match those recorded by Search.
+func Context(path string, opts ContextOptions) (ContextResult, error) {
+	result := ContextResult{File: path, Lines: []ContextLine{}}
+	if IsJournalPath(path) {
+		return result, errJournalContext
+	}
+
+	before := clampContext(opts.Before)
+	after := clampContext(opts.After)
+
+	rc, err := openLogReader(path)
+	if err != nil {
+		return result, err
+	}
+	defer rc.Close()
+
+	reader := bufio.NewReaderSize(rc, 64*1024)
+	var ring []ContextLine // Recent lines before the hit, trimmed lazily
+	target := -1           // Index in result.Lines of the requested line
+	lineNo := 0
+	var offset int64
+
+	for {
+		text, readErr := reader.ReadString('\n')
+		if len(text) > 0 {
+			lineNo++
+			cl := ContextLine{Line: lineNo, Offset: offset, Text: strings.TrimRight(text, "\r\n")}
+			offset += int64(len(text))
+
+			if target < 0 {
+				isTarget := (opts.Line > 0 && lineNo == opts.Line) ||
+					(opts.Line <= 0 && opts.Offset >= cl.Offset && opts.Offset < offset)
+				if !isTarget {
+					ring = append(ring, cl)
+					if len(ring) > 2*before+64 {
+						ring = append(ring[:0], ring[len(ring)-before:]...)
+					}
+					continue
+				}
+				if len(ring) > before {
+					ring = ring[len(ring)-before:]
+				}
+				result.HasMoreBefore = lineNo-1 > before
+				cl.Match = true
+				result.Lines = append(result.Lines, ring...)
+				target = len(result.Lines)
+				result.Lines = append(result.Lines, cl)
+				ring = nil
+				continue
+			}
+
+			if len(result.Lines)-target-1 >= after {
+				result.HasMoreAfter = true
+				break
+			}
+			result.Lines = append(result.Lines, cl)
+		}
+
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return result, readErr
+		}
+	}
+
+	if target < 0 {
+		if opts.Line > 0 {
+			return result, fmt.Errorf("line %d is beyond the end of the file", opts.Line)
+		}
+		return result, fmt.Errorf("offset %d is beyond the end of the file", opts.Offset)
+	}
+	for i := range result.Lines {
+		result.Lines[i].Text = redactApps(result.Lines[i].Text, opts.Apps...)
+	}
+	return result, nil
+}
+
+// clampContext bounds the number of context lines
+func clampContext(n int) int {
+	if n < 0 {
+		return 0
+	}
+	if n > maxContextLines {
+		return maxContextLines
+	}
+	return n
+}
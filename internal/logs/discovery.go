@@ -2,48 +2,229 @@ package logs
 
 import (
 	"fmt"
+	"io/fs"
 	"log"
 	"logmojo/internal/config"
 	"os"
 	"path/filepath"
-	"sort"
 	"strings"
 	"time"
 )
 
+// LogFile is one file of a log source. Files of the same rotation family
+// share a Family stem; Rotation is 0 for the file being written and counts
+// up from the newest rotated file to the oldest. Start and End estimate the
+// time the file covers (Start is zero when unknown).
 type LogFile struct {
 	Name      string    `json:"name"`
 	Path      string    `json:"path"`
 	Size      int64     `json:"size"`
 	ModTime   time.Time `json:"mod_time"`
 	IsArchive bool      `json:"is_archive"`
+	Family    string    `json:"family"`
+	Rotation  int       `json:"rotation"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
 }
 
-// ListFiles returns all log files associated with a specific configured log entry
-func ListFiles(appName, logName string) ([]LogFile, error) {
-	var targetPath string
-	found := false
-
-	// Find config
-	for _, app := range config.AppConfigData.Apps {
+// FindLogConfig returns the configured log entry for an app/log pair
+func FindLogConfig(appName, logName string) (config.LogConfig, bool) {
+	for _, app := range config.Apps() {
 		if app.Name == appName {
 			for _, l := range app.Logs {
 				if l.Name == logName {
-					targetPath = l.Path
-					found = true
+					return l, true
+				}
+			}
+		}
+	}
+	return config.LogConfig{}, false
+}
+
+// IsLogFile reports whether path is one of the files of the log entry
+// logName of appName, so file parameters cannot be used to read arbitrary
+// files or the files of another app under this app's rules
+func IsLogFile(appName, logName, path string) bool {
+	_, ok := findLogFile(appName, logName, path)
+	return ok
+}
+
+// findLogFile returns path among the files of a log entry
+func findLogFile(appName, logName, path string) (LogFile, bool) {
+	files, err := ListFiles(appName, logName)
+	if err != nil {
+		return LogFile{}, false
+	}
+	for _, f := range files {
+		if f.Path == path {
+			return f, true
+		}
+	}
+	return LogFile{}, false
+}
+
+// ConfiguredFileApps returns the apps with a log entry that includes path
+func ConfiguredFileApps(path string) []string {
+	owners := make(map[string][]string)
+	addFileApps(owners, []string{path}, nil)
+	return owners[path]
+}
+
+// addFileApps adds to owners the apps with a log entry that includes one of
+// paths. Only the entries that can hold one of the paths are listed, and
+// none for which skip returns true.
+func addFileApps(owners map[string][]string, paths []string, skip func(app string, l config.LogConfig) bool) {
+	wanted := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		wanted[p] = true
+	}
+	add := func(path, app string) {
+		if !containsString(owners[path], app) {
+			owners[path] = append(owners[path], app)
+		}
+	}
+
+	for _, app := range config.Apps() {
+		for _, l := range app.Logs {
+			if skip != nil && skip(app.Name, l) {
+				continue
+			}
+			if IsJournal(l) {
+				if p := journalFile(l).Path; wanted[p] {
+					add(p, app.Name)
+				}
+				continue
+			}
+			root := sourceRoot(l)
+			holds := false
+			for _, p := range paths {
+				if withinDir(root, p) {
+					holds = true
 					break
 				}
 			}
+			if !holds {
+				continue
+			}
+			files, err := ListFiles(app.Name, l.Name)
+			if err != nil {
+				continue
+			}
+			for _, f := range files {
+				if wanted[f.Path] {
+					add(f.Path, app.Name)
+				}
+			}
 		}
 	}
+}
+
+// sourceRoot returns the directory every file of a log entry is under
+func sourceRoot(l config.LogConfig) string {
+	switch {
+	case IsDocker(l):
+		return dockerRoot(l)
+	case IsGlob(l.Path):
+		return globRoot(filepath.Clean(l.Path))
+	}
+	if info, err := os.Stat(l.Path); err == nil && info.IsDir() {
+		return l.Path
+	}
+	return filepath.Dir(l.Path)
+}
+
+// withinDir reports whether path is inside dir or one of its subdirectories
+func withinDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
 
+// ListFiles returns all log files associated with a specific configured log entry
+func ListFiles(appName, logName string) ([]LogFile, error) {
+	logCfg, found := FindLogConfig(appName, logName)
 	if !found {
 		log.Printf("[DISCOVERY] Config not found for app=%s, log=%s", appName, logName)
 		return nil, fmt.Errorf("log configuration not found")
 	}
 
-	log.Printf("[DISCOVERY] Found path: %s for app=%s, log=%s", targetPath, appName, logName)
+	log.Printf("[DISCOVERY] Found path: %s for app=%s, log=%s", logCfg.Path, appName, logName)
+
+	files, err := sourceFiles(logCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("[DISCOVERY] Found %d files for app=%s, log=%s", len(files), appName, logName)
+	return files, nil
+}
+
+// sourceFiles returns the files of a log entry, newest first with rotations
+// in sequence
+func sourceFiles(logCfg config.LogConfig) ([]LogFile, error) {
+	// The journal is read through journalctl, as one virtual file
+	if IsJournal(logCfg) {
+		return []LogFile{journalFile(logCfg)}, nil
+	}
+
+	var files []LogFile
+	var err error
+	if IsDocker(logCfg) {
+		files, err = dockerFiles(logCfg)
+	} else {
+		files, err = resolveFiles(logCfg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return orderRotations(files, logCfg), nil
+}
 
+// liveFiles returns the files of a log entry that are being written: the
+// current file of each rotation family, or the newest file when every file
+// is an archive. A single-file source that does not exist yet yields its
+// configured path, so a tail can wait for it to appear.
+func liveFiles(logCfg config.LogConfig) ([]LogFile, error) {
+	files, err := sourceFiles(logCfg)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		if logCfg.Path != "" && !IsGlob(logCfg.Path) && !IsDocker(logCfg) {
+			if info, statErr := os.Stat(logCfg.Path); statErr != nil || !info.IsDir() {
+				name := filepath.Base(logCfg.Path)
+				return []LogFile{{Name: name, Path: logCfg.Path, Family: parseRotationName(name).stem}}, nil
+			}
+		}
+		return nil, nil
+	}
+
+	var live []LogFile
+	for _, f := range files {
+		if !f.IsArchive {
+			live = append(live, f)
+		}
+	}
+	if len(live) == 0 {
+		live = files[:1]
+	}
+	return live, nil
+}
+
+// resolveFiles finds the files of a log source: the matches of a glob, the
+// log files in a directory (and its subdirectories if recursive), or a single
+// file and its rotated copies. Include and exclude patterns apply
+// to all of them.
+func resolveFiles(logCfg config.LogConfig) ([]LogFile, error) {
+	filter, err := newFileFilter(logCfg.Include, logCfg.Exclude)
+	if err != nil {
+		return nil, fmt.Errorf("invalid include/exclude pattern: %w", err)
+	}
+
+	if IsGlob(logCfg.Path) {
+		return globFiles(logCfg.Path, filter)
+	}
+
+	targetPath := logCfg.Path
 	info, err := os.Stat(targetPath)
 	if os.IsNotExist(err) {
 		// File might not exist yet, but maybe archives do?
@@ -57,68 +238,87 @@ func ListFiles(appName, logName string) ([]LogFile, error) {
 	var files []LogFile
 
 	if info.IsDir() {
-		entries, err := os.ReadDir(targetPath)
-		if err != nil {
-			return nil, err
+		depth := 0
+		if logCfg.Recursive {
+			depth = -1
 		}
-		for _, e := range entries {
-			if e.IsDir() {
-				continue
+		err := walkFiles(targetPath, depth, func(path, rel string, fInfo fs.FileInfo) {
+			if filter.excluded(rel) || !filter.included(rel) {
+				return
 			}
-			fInfo, _ := e.Info()
-			fullPath := filepath.Join(targetPath, e.Name())
-			name := strings.ToLower(e.Name())
-
-			if !isLogFile(name) {
-				continue
+			// Without include patterns, keep names that look like logs
+			if len(logCfg.Include) == 0 && !isLogFile(fInfo.Name()) {
+				return
 			}
-
 			files = append(files, LogFile{
-				Name:      e.Name(),
-				Path:      fullPath,
-				Size:      fInfo.Size(),
-				ModTime:   fInfo.ModTime(),
-				IsArchive: isArchive(e.Name()),
+				Name:    filepath.ToSlash(rel),
+				Path:    path,
+				Size:    fInfo.Size(),
+				ModTime: fInfo.ModTime(),
 			})
-		}
-	} else {
-		// If file, add itself
-		files = append(files, LogFile{
-			Name:      filepath.Base(targetPath),
-			Path:      targetPath,
-			Size:      info.Size(),
-			ModTime:   info.ModTime(),
-			IsArchive: false,
 		})
+		if err != nil {
+			return nil, err
+		}
+		return files, nil
+	}
 
-		// Look for rotated siblings
-		dir := filepath.Dir(targetPath)
-		base := filepath.Base(targetPath)
+	// If file, add itself and the rest of its rotation family
+	files = append(files, LogFile{
+		Name:    filepath.Base(targetPath),
+		Path:    targetPath,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	})
+	return append(files, familySiblings(targetPath, filter)...), nil
+}
 
-		siblings, _ := os.ReadDir(dir)
-		for _, s := range siblings {
-			if s.IsDir() || s.Name() == base {
-				continue
-			}
-			if strings.HasPrefix(s.Name(), base) {
-				sInfo, _ := s.Info()
-				files = append(files, LogFile{
-					Name:      s.Name(),
-					Path:      filepath.Join(dir, s.Name()),
-					Size:      sInfo.Size(),
-					ModTime:   sInfo.ModTime(),
-					IsArchive: true, // Assume siblings are archives
-				})
-			}
+// globFiles returns the files matching a glob pattern and the rest of their
+// rotation families. The glob selects the files, so there is no log name heuristic.
+func globFiles(pattern string, filter *fileFilter) ([]LogFile, error) {
+	pattern = filepath.Clean(pattern)
+	re, err := compileGlob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid path pattern: %w", err)
+	}
+
+	// Without "**" matches are at a fixed depth below the root
+	root := globRoot(pattern)
+	depth := -1
+	if !strings.Contains(pattern, "**") {
+		rel := strings.TrimPrefix(strings.TrimPrefix(pattern, root), string(filepath.Separator))
+		depth = strings.Count(filepath.ToSlash(rel), "/")
+	}
+
+	files := []LogFile{}
+	seen := make(map[string]bool)
+	add := func(f LogFile) {
+		if !seen[f.Path] {
+			seen[f.Path] = true
+			files = append(files, f)
 		}
 	}
 
-	// Sort by ModTime DESC (newest first)
-	sort.Slice(files, func(i, j int) bool {
-		return files[i].ModTime.After(files[j].ModTime)
+	err = walkFiles(root, depth, func(path, rel string, fInfo fs.FileInfo) {
+		if !re.MatchString(filepath.ToSlash(path)) || filter.excluded(rel) || !filter.included(rel) {
+			return
+		}
+		add(LogFile{
+			Name:    filepath.ToSlash(rel),
+			Path:    path,
+			Size:    fInfo.Size(),
+			ModTime: fInfo.ModTime(),
+		})
+		for _, s := range familySiblings(path, filter) {
+			add(s)
+		}
 	})
-
-	log.Printf("[DISCOVERY] Found %d files for app=%s, log=%s", len(files), appName, logName)
+	if os.IsNotExist(err) {
+		return files, nil
+	}
+	if err != nil {
+		return nil, err
+	}
 	return files, nil
 }
 
@@ -154,30 +354,3 @@ func isLogFile(name string) bool {
 
 	return false
 }
-
-func isArchive(name string) bool {
-	lower := strings.ToLower(name)
-
-	// Compressed archives
-	compressedExts := []string{".gz", ".bz2", ".xz", ".lz4", ".zip"}
-	for _, ext := range compressedExts {
-		if strings.HasSuffix(lower, ext) {
-			return true
-		}
-	}
-
-	// Rotated files
-	rotationPatterns := []string{".1", ".2", ".3", ".4", ".5", ".old", ".bak"}
-	for _, pattern := range rotationPatterns {
-		if strings.HasSuffix(lower, pattern) {
-			return true
-		}
-	}
-
-	// Date-based rotations
-	if strings.Contains(lower, ".log.") && !strings.HasSuffix(lower, ".log") {
-		return true
-	}
-
-	return false
-}
@@ -0,0 +1,309 @@
+package logs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"logmojo/internal/config"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultDockerRoot   = "/var/lib/docker/containers"
+	defaultDockerSocket = "/var/run/docker.sock"
+	dockerAPITimeout    = 3 * time.Second
+)
+
+// Container is a Docker container found on this host
+type Container struct {
+	ID     string            `json:"id"`
+	Name   string            `json:"name"`
+	Image  string            `json:"image"`
+	State  string            `json:"state"`
+	Labels map[string]string `json:"labels"`
+	// LogPath is the json-file log of the container
+	LogPath string `json:"log_path"`
+}
+
+// Container names by ID, remembered from discovery for parsed results
+var containerNames = struct {
+	sync.RWMutex
+	byID map[string]string
+}{byID: make(map[string]string)}
+
+// IsDocker reports whether a log source reads Docker container logs
+func IsDocker(cfg config.LogConfig) bool {
+	return strings.EqualFold(cfg.Type, "docker")
+}
+
+// dockerRoot is the containers directory of a docker source
+func dockerRoot(cfg config.LogConfig) string {
+	if cfg.Path != "" {
+		return cfg.Path
+	}
+	return defaultDockerRoot
+}
+
+// dockerSocket returns the Engine API socket, from DOCKER_HOST when it is a
+// unix socket
+func dockerSocket() string {
+	if host := os.Getenv("DOCKER_HOST"); strings.HasPrefix(host, "unix://") {
+		return strings.TrimPrefix(host, "unix://")
+	}
+	return defaultDockerSocket
+}
+
+// ListContainers returns the containers of this host. They are asked from the
+// Engine API when its socket is reachable, and otherwise read from the
+// config.v2.json files under root (e.g. a read-only mount of the host's
+// /var/lib/docker/containers).
+func ListContainers(ctx context.Context, root string) ([]Container, error) {
+	if root == "" {
+		root = defaultDockerRoot
+	}
+
+	containers, err := containersFromAPI(ctx, dockerSocket(), root)
+	if err != nil {
+		containers, err = containersFromDisk(root)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	containerNames.Lock()
+	for _, c := range containers {
+		containerNames.byID[c.ID] = c.Name
+	}
+	containerNames.Unlock()
+	return containers, nil
+}
+
+// containersFromAPI lists containers through the Engine API. Logs are still
+// read from disk, where the json-file driver keeps them next to the config.
+func containersFromAPI(ctx context.Context, socket, root string) ([]Container, error) {
+	if _, err := os.Stat(socket); err != nil {
+		return nil, err
+	}
+	client := &http.Client{
+		Timeout: dockerAPITimeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://docker/containers/json?all=1", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("docker API: %s", resp.Status)
+	}
+
+	var list []struct {
+		ID     string            `json:"Id"`
+		Names  []string          `json:"Names"`
+		Image  string            `json:"Image"`
+		State  string            `json:"State"`
+		Labels map[string]string `json:"Labels"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("docker API: %w", err)
+	}
+
+	containers := make([]Container, 0, len(list))
+	for _, c := range list {
+		name := c.ID
+		if len(c.Names) > 0 {
+			name = strings.TrimPrefix(c.Names[0], "/")
+		}
+		containers = append(containers, Container{
+			ID:      c.ID,
+			Name:    name,
+			Image:   c.Image,
+			State:   c.State,
+			Labels:  c.Labels,
+			LogPath: filepath.Join(root, c.ID, c.ID+"-json.log"),
+		})
+	}
+	return containers, nil
+}
+
+// containersFromDisk reads the container configs Docker keeps under root
+func containersFromDisk(root string) ([]Container, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var containers []Container
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(root, e.Name(), "config.v2.json"))
+		if err != nil {
+			continue
+		}
+		var cfg struct {
+			ID     string `json:"ID"`
+			Name   string `json:"Name"`
+			State  struct{ Running bool }
+			Config struct {
+				Image  string            `json:"Image"`
+				Labels map[string]string `json:"Labels"`
+			}
+			LogPath string `json:"LogPath"`
+		}
+		if err := json.Unmarshal(data, &cfg); err != nil || cfg.ID == "" {
+			continue
+		}
+
+		state := "exited"
+		if cfg.State.Running {
+			state = "running"
+		}
+		logPath := cfg.LogPath
+		if logPath == "" {
+			logPath = filepath.Join(root, cfg.ID, cfg.ID+"-json.log")
+		}
+		containers = append(containers, Container{
+			ID:      cfg.ID,
+			Name:    strings.TrimPrefix(cfg.Name, "/"),
+			Image:   cfg.Config.Image,
+			State:   state,
+			Labels:  cfg.Config.Labels,
+			LogPath: logPath,
+		})
+	}
+	return containers, nil
+}
+
+// matchContainer reports whether a container is selected by a docker source:
+// container is a name, name glob or ID prefix, and every label must be set
+// ("key") or have the given value ("key=value")
+func matchContainer(c Container, container string, labels []string) bool {
+	if container != "" {
+		switch {
+		case IsGlob(container):
+			re, err := compileGlob(container)
+			if err != nil || !re.MatchString(c.Name) {
+				return false
+			}
+		case c.Name == container:
+		case len(container) >= 4 && strings.HasPrefix(c.ID, container):
+		default:
+			return false
+		}
+	}
+	for _, l := range labels {
+		key, value, hasValue := strings.Cut(l, "=")
+		v, ok := c.Labels[key]
+		if !ok || (hasValue && v != value) {
+			return false
+		}
+	}
+	return true
+}
+
+// dockerFiles returns the json-file logs of the containers a source selects,
+// with their rotations
+func dockerFiles(cfg config.LogConfig) ([]LogFile, error) {
+	if cfg.Container == "" && len(cfg.Labels) == 0 {
+		return nil, fmt.Errorf("docker source needs a container or labels")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), dockerAPITimeout)
+	defer cancel()
+	containers, err := ListContainers(ctx, dockerRoot(cfg))
+	if err != nil {
+		return nil, err
+	}
+
+	var files []LogFile
+	for _, c := range containers {
+		if !matchContainer(c, cfg.Container, cfg.Labels) {
+			continue
+		}
+		info, err := os.Stat(c.LogPath)
+		if err != nil {
+			log.Printf("[DISCOVERY] No json-file log for container %s: %v", c.Name, err)
+			continue
+		}
+		base := filepath.Base(c.LogPath)
+		files = append(files, LogFile{
+			Name:    c.Name,
+			Path:    c.LogPath,
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+		// json-file rotates to <id>-json.log.1 and up (max-file)
+		for _, s := range familySiblings(c.LogPath, &fileFilter{}) {
+			s.Name = c.Name + strings.TrimPrefix(s.Name, base)
+			files = append(files, s)
+		}
+	}
+	return files, nil
+}
+
+// dockerLine is one line of a json-file log
+type dockerLine struct {
+	Log    string    `json:"log"`
+	Stream string    `json:"stream"`
+	Time   time.Time `json:"time"`
+}
+
+func parseDockerLine(line string) (dockerLine, bool) {
+	var l dockerLine
+	if !strings.HasPrefix(line, "{") || json.Unmarshal([]byte(line), &l) != nil || l.Stream == "" {
+		return l, false
+	}
+	return l, true
+}
+
+// parseDocker unwraps json-file lines and parses what the container wrote
+// with the source's format. The container's own timestamp wins over the
+// time Docker received the line.
+func (p *Parser) parseDocker(appName, path, content string) (LogResult, bool) {
+	lines := strings.Split(content, "\n")
+	first, ok := parseDockerLine(lines[0])
+	if !ok {
+		return p.parseEvent(appName, path, content)
+	}
+
+	result, hasTimestamp := p.parseEvent(appName, path, p.Payload(content))
+	if !hasTimestamp && !first.Time.IsZero() {
+		result.Timestamp = first.Time
+		hasTimestamp = true
+	}
+
+	if result.Fields == nil {
+		result.Fields = make(map[string]string)
+	}
+	result.Fields["stream"] = first.Stream
+	id := filepath.Base(filepath.Dir(path))
+	containerNames.RLock()
+	name, ok := containerNames.byID[id]
+	containerNames.RUnlock()
+	if !ok && len(id) > 12 {
+		name = id[:12]
+	}
+	if name != "" {
+		result.Fields["container"] = name
+	}
+	return result, hasTimestamp
+}
@@ -0,0 +1,160 @@
+package logs
+
+import (
+	"context"
+	"encoding/json"
+	"logmojo/internal/config"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Container of the fixtures under testdata/docker
+const fixtureContainerID = "4b5e57f6eb2f42b9039b3d1e13929295f231749c510cbe341cd68036d9af97e2"
+
+// fakeEngine serves the Engine API container list on a unix socket and
+// points DOCKER_HOST at it
+func fakeEngine(t *testing.T, list interface{}) {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "docker.sock")
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/containers/json", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("all") != "1" {
+			t.Errorf("container list without all=1: %s", r.URL)
+		}
+		json.NewEncoder(w).Encode(list)
+	})
+	srv := &http.Server{Handler: mux}
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+	t.Setenv("DOCKER_HOST", "unix://"+socket)
+}
+
+// noEngine makes container discovery fall back to the files on disk
+func noEngine(t *testing.T) {
+	t.Setenv("DOCKER_HOST", "unix://"+filepath.Join(t.TempDir(), "missing.sock"))
+}
+
+func TestListContainersFromDisk(t *testing.T) {
+	noEngine(t)
+	containers, err := ListContainers(context.Background(), "testdata/docker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(containers) != 1 {
+		t.Fatalf("got %d containers, want 1", len(containers))
+	}
+	c := containers[0]
+	if c.ID != fixtureContainerID || c.Name != "web" || c.State != "running" || c.Image != "example/web:1.4" {
+		t.Errorf("unexpected container %+v", c)
+	}
+	if want := filepath.Join("testdata/docker", fixtureContainerID, fixtureContainerID+"-json.log"); c.LogPath != want {
+		t.Errorf("LogPath = %q, want %q", c.LogPath, want)
+	}
+}
+
+func TestListContainersFromAPI(t *testing.T) {
+	fakeEngine(t, []map[string]interface{}{
+		{"Id": fixtureContainerID, "Names": []string{"/web-renamed"}, "Image": "example/web:1.5", "State": "running", "Labels": map[string]string{"tier": "frontend"}},
+		{"Id": "0123456789abcdef", "Names": []string{"/worker"}, "State": "exited"},
+	})
+	containers, err := ListContainers(context.Background(), "testdata/docker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(containers) != 2 {
+		t.Fatalf("got %d containers, want 2", len(containers))
+	}
+	if c := containers[0]; c.Name != "web-renamed" || c.Image != "example/web:1.5" || c.Labels["tier"] != "frontend" {
+		t.Errorf("unexpected container %+v", c)
+	}
+	if c := containers[1]; c.Name != "worker" || c.State != "exited" {
+		t.Errorf("unexpected container %+v", c)
+	}
+}
+
+func TestMatchContainer(t *testing.T) {
+	c := Container{ID: fixtureContainerID, Name: "web", Labels: map[string]string{"tier": "frontend", "com.example.team": "payments"}}
+	tests := []struct {
+		container string
+		labels    []string
+		want      bool
+	}{
+		{"web", nil, true},
+		{"we*", nil, true},
+		{"api", nil, false},
+		{"4b5e57f6", nil, true},
+		{"4b5", nil, false}, // ID prefixes need 4 characters
+		{"", []string{"tier"}, true},
+		{"", []string{"tier=frontend"}, true},
+		{"", []string{"tier=backend"}, false},
+		{"web", []string{"tier", "com.example.team=payments"}, true},
+		{"web", []string{"missing"}, false},
+	}
+	for _, tt := range tests {
+		if got := matchContainer(c, tt.container, tt.labels); got != tt.want {
+			t.Errorf("matchContainer(%q, %v) = %v, want %v", tt.container, tt.labels, got, tt.want)
+		}
+	}
+}
+
+// useDockerApp configures a single app reading the fixture container
+func useDockerApp(t *testing.T, multiline config.MultilineConfig) {
+	t.Helper()
+	noEngine(t)
+	saved := config.AppConfigData
+	t.Cleanup(func() { config.AppConfigData = saved })
+	config.AppConfigData = config.Config{Apps: []config.AppConfig{{
+		Name: "shop",
+		Logs: []config.LogConfig{{Name: "web", Type: "docker", Path: "testdata/docker", Container: "web", Multiline: multiline}},
+	}}}
+}
+
+func TestSearchDockerUnwrapsLines(t *testing.T) {
+	useDockerApp(t, config.MultilineConfig{Mode: "timestamp"})
+
+	tests := []struct {
+		name  string
+		opts  SearchOptions
+		count int
+	}{
+		{"all events", SearchOptions{}, 3},
+		{"wrapper keys do not match", SearchOptions{Query: "stream OR time OR log"}, 0},
+		{"anchored regex sees the payload", SearchOptions{Query: "^2024-01-15", Regex: true}, 3},
+		{"continuation lines match their event", SearchOptions{Query: "Pool.acquire"}, 1},
+		{"stream field", SearchOptions{Query: "stream:stderr"}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.App = "shop"
+			page, err := Search(context.Background(), tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(page.Results) != tt.count {
+				t.Errorf("got %d results, want %d: %+v", len(page.Results), tt.count, page.Results)
+			}
+		})
+	}
+
+	page, err := Search(context.Background(), SearchOptions{App: "shop", Query: "IllegalStateException"})
+	if err != nil || len(page.Results) != 1 {
+		t.Fatalf("got %v, %v", page.Results, err)
+	}
+	r := page.Results[0]
+	if r.Level != "ERROR" || r.Fields["stream"] != "stderr" || r.Fields["container"] != "web" {
+		t.Errorf("unexpected result %+v", r)
+	}
+	if strings.Contains(r.Message, `"stream"`) || !strings.Contains(r.Message, "\tat com.example.web.Handler.handle") {
+		t.Errorf("message not unwrapped: %q", r.Message)
+	}
+	if r.Line != 2 {
+		t.Errorf("Line = %d, want 2", r.Line)
+	}
+}
@@ -0,0 +1,158 @@
+package logs
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Frames used for the fingerprint; deeper frames are mostly framework code
+const maxFingerprintFrames = 10
+
+var (
+	// Java, Kotlin, Scala, C# and JS style types such as java.lang.IllegalStateException
+	exceptionHeaderRe = regexp.MustCompile(`(?:^|[\s:"'(\[])((?:[A-Za-z_$][\w$]*\.)*[A-Z][\w$]*(?:Exception|Error|Throwable|Fault))\b(?::\s*(.*))?`)
+	// panic: runtime error: index out of range / fatal error: concurrent map writes
+	goPanicRe = regexp.MustCompile(`(?:^|\s)(panic|fatal error): (.*)`)
+	// Last line of a Python traceback: ValueError: invalid literal
+	pythonTypeRe = regexp.MustCompile(`^([A-Za-z_][\w.]*)(?::\s?(.*))?$`)
+
+	pythonFrameRe = regexp.MustCompile(`^\s*File "([^"]+)", line (\d+), in (.+)$`)
+	jsFrameRe     = regexp.MustCompile(`^\s*at (?:(.+?) \()?(.+?):(\d+):\d+\)?$`)
+	javaFrameRe   = regexp.MustCompile(`^\s*at ([\w$.<>/]+)\(([^:)]*)(?::(\d+))?\)`)
+	goFuncRe      = regexp.MustCompile(`^([\w./*()-]+)\(.*\)$`)
+	goFileRe      = regexp.MustCompile(`^\s+(\S+\.go):(\d+)`)
+)
+
+// StackFrame is one frame of a stack trace
+type StackFrame struct {
+	Function string `json:"function"`
+	File     string `json:"file,omitempty"`
+	Line     int    `json:"line,omitempty"`
+}
+
+// Exception is an error parsed out of a log event
+type Exception struct {
+	Type        string       `json:"type"`
+	Message     string       `json:"message"`
+	Frames      []StackFrame `json:"frames"`
+	Fingerprint string       `json:"fingerprint"`
+}
+
+// ParseException extracts the exception type, message and stack frames from
+// a log event (Java/JVM, Python, Go panics and JavaScript) and fingerprints
+// it. It reports false when no exception type is recognised; Type is then
+// empty and the fingerprint comes from the masked first line, so repeats of
+// the same message still group together.
+func ParseException(text string) (Exception, bool) {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+
+	var exc Exception
+	if isPythonTraceback(lines) {
+		exc = parsePython(lines)
+	} else {
+		exc = parseStackTrace(lines)
+	}
+
+	ok := exc.Type != ""
+	if !ok {
+		exc.Message = strings.TrimSpace(lines[0])
+	}
+	exc.Fingerprint = exc.fingerprint()
+	return exc, ok
+}
+
+func isPythonTraceback(lines []string) bool {
+	for _, l := range lines {
+		if strings.Contains(l, "Traceback (most recent call last)") {
+			return true
+		}
+	}
+	return false
+}
+
+// parsePython reads the frames of a traceback and the type from its last line
+func parsePython(lines []string) Exception {
+	var exc Exception
+	inTrace := false
+	for _, l := range lines {
+		if strings.Contains(l, "Traceback (most recent call last)") {
+			inTrace = true
+			exc.Frames = nil // Chained exceptions: keep the last traceback
+			continue
+		}
+		if !inTrace {
+			continue
+		}
+		if m := pythonFrameRe.FindStringSubmatch(l); m != nil {
+			line, _ := strconv.Atoi(m[2])
+			exc.Frames = append(exc.Frames, StackFrame{Function: m[3], File: m[1], Line: line})
+			continue
+		}
+		if strings.HasPrefix(l, " ") || strings.HasPrefix(l, "\t") {
+			continue // Source line under a frame
+		}
+		if m := pythonTypeRe.FindStringSubmatch(strings.TrimSpace(l)); m != nil {
+			exc.Type, exc.Message = m[1], m[2]
+		}
+	}
+	return exc
+}
+
+// parseStackTrace handles JVM, JavaScript and Go traces, which start with
+// the error and list frames below it
+func parseStackTrace(lines []string) Exception {
+	var exc Exception
+	for i, l := range lines {
+		if exc.Type == "" {
+			if m := goPanicRe.FindStringSubmatch(l); m != nil {
+				exc.Type, exc.Message = m[1], m[2]
+				continue
+			}
+			if m := exceptionHeaderRe.FindStringSubmatch(l); m != nil {
+				exc.Type, exc.Message = m[1], strings.TrimSpace(m[2])
+				continue
+			}
+		}
+		// Frames of a cause belong to a different exception
+		if strings.HasPrefix(strings.TrimSpace(l), "Caused by:") {
+			break
+		}
+
+		if m := jsFrameRe.FindStringSubmatch(l); m != nil {
+			line, _ := strconv.Atoi(m[3])
+			exc.Frames = append(exc.Frames, StackFrame{Function: m[1], File: m[2], Line: line})
+		} else if m := javaFrameRe.FindStringSubmatch(l); m != nil {
+			line, _ := strconv.Atoi(m[3])
+			exc.Frames = append(exc.Frames, StackFrame{Function: m[1], File: m[2], Line: line})
+		} else if m := goFileRe.FindStringSubmatch(l); m != nil && i > 0 {
+			if fn := goFuncRe.FindStringSubmatch(lines[i-1]); fn != nil {
+				line, _ := strconv.Atoi(m[2])
+				exc.Frames = append(exc.Frames, StackFrame{Function: fn[1], File: m[1], Line: line})
+			}
+		}
+	}
+	return exc
+}
+
+// fingerprint hashes the type and the shape of the stack. Line numbers and
+// directories are left out so the same error groups across deploys; without
+// frames the masked message stands in for the stack.
+func (e Exception) fingerprint() string {
+	var b strings.Builder
+	b.WriteString(e.Type)
+	if len(e.Frames) == 0 {
+		b.WriteString("\n" + MaskMessage(e.Message))
+	}
+	for i, f := range e.Frames {
+		if i == maxFingerprintFrames {
+			break
+		}
+		fmt.Fprintf(&b, "\n%s|%s", f.Function, filepath.Base(f.File))
+	}
+	hash := sha256.Sum256([]byte(b.String()))
+	return fmt.Sprintf("%x", hash[:8])
+}
@@ -0,0 +1,108 @@
+package logs
+
+import (
+	"context"
+	"log"
+	"sort"
+)
+
+const (
+	maxFacets           = 50    // Top values per field
+	maxFacetFields      = 50    // Structured fields tracked besides level, app and file
+	maxFacetCardinality = 10000 // Distinct values tracked per field
+)
+
+// FacetValue is one value of a field and the number of matches that have it
+type FacetValue struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// Facets summarises the top values of level, app, file and structured fields
+// over all matches of a search, not just the current page
+type Facets struct {
+	Fields  map[string][]FacetValue `json:"fields"`
+	Total   int                     `json:"total"`   // Matches counted
+	Partial bool                    `json:"partial"` // Counting stopped early (time budget)
+}
+
+// facetCounter accumulates value counts per field
+type facetCounter struct {
+	counts map[string]map[string]int
+}
+
+func (f *facetCounter) add(field, value string) {
+	values, ok := f.counts[field]
+	if !ok {
+		if len(f.counts) >= maxFacetFields+3 {
+			return
+		}
+		values = make(map[string]int)
+		f.counts[field] = values
+	}
+	if _, ok := values[value]; !ok && len(values) >= maxFacetCardinality {
+		return
+	}
+	values[value]++
+}
+
+// top returns the n most frequent values of every field
+func (f *facetCounter) top(n int) map[string][]FacetValue {
+	out := make(map[string][]FacetValue, len(f.counts))
+	for field, values := range f.counts {
+		list := make([]FacetValue, 0, len(values))
+		for v, c := range values {
+			list = append(list, FacetValue{Value: v, Count: c})
+		}
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].Count != list[j].Count {
+				return list[i].Count > list[j].Count
+			}
+			return list[i].Value < list[j].Value
+		})
+		if len(list) > n {
+			list = list[:n]
+		}
+		out[field] = list
+	}
+	return out
+}
+
+// searchFacets counts the top n values per field over every match in targets
+func searchFacets(ctx context.Context, targets []searchTarget, query *Query, opts SearchOptions, n int) (*Facets, error) {
+	if n > maxFacets {
+		n = maxFacets
+	}
+
+	budget, cancel := context.WithTimeout(ctx, searchTimeout)
+	defer cancel()
+
+	facets := &Facets{}
+	counter := facetCounter{counts: make(map[string]map[string]int)}
+	for _, target := range targets {
+		err := walkFile(budget, target, query, opts, 0, func(hit searchHit, hasTimestamp bool) {
+			r := hit.result
+			facets.Total++
+			counter.add("level", r.Level)
+			counter.add("app", r.App)
+			counter.add("file", r.File)
+			for k, v := range r.Fields {
+				counter.add(k, v)
+			}
+		})
+		if err != nil && budget.Err() != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			log.Printf("[LOGS] Facet counting timeout after %s, returning partial facets", searchTimeout)
+			facets.Partial = true
+			break
+		}
+		if err != nil {
+			log.Printf("[LOGS] Failed to search %s: %v", target.Path, err)
+		}
+	}
+
+	facets.Fields = counter.top(n)
+	return facets, nil
+}
@@ -0,0 +1,328 @@
+package logs
+
+import (
+	"context"
+	"io"
+	"log"
+	"logmojo/internal/config"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// How often followed files are read, and how often a source is listed
+	// again for new and rotated files
+	followPollInterval = 250 * time.Millisecond
+	followScanInterval = 2 * time.Second
+	// Files one StreamLog follows at once
+	maxFollowFiles = 50
+	// Longest line kept while waiting for its newline, as in the scanners
+	maxFollowLine = 1024 * 1024
+	followChunk   = 64 * 1024
+)
+
+// Kinds of TailEvent
+const (
+	TailLine      = "line"
+	TailRotated   = "rotated"
+	TailTruncated = "truncated"
+)
+
+// TailEvent is what StreamLog sends: an entry of a followed file, or a notice
+// that a file was rotated (replaced, or succeeded by a newer file) or
+// truncated in place
+type TailEvent struct {
+	Kind   string
+	Text   string
+	File   string // File of the entry; for a rotation, the file followed from now on
+	From   string // File followed before a rotation, empty for a file that just appeared
+	Offset int64  // Byte offset of the entry in File
+}
+
+// followedFile is one file read by a follower
+type followedFile struct {
+	path          string
+	family        string // Directory and rotation stem
+	file          *os.File
+	info          os.FileInfo
+	pending       []byte // Read bytes of a line without its newline yet
+	pendingOffset int64
+	grouper       lineGrouper
+	lastLine      time.Time
+}
+
+// follower follows the live files of one log source
+type follower struct {
+	ctx      context.Context
+	source   config.LogConfig
+	rule     *multilineRule
+	out      chan<- TailEvent
+	files    map[string]*followedFile
+	limitHit bool
+}
+
+// send delivers an event, returning false once ctx is cancelled
+func (fl *follower) send(ev TailEvent) bool {
+	select {
+	case <-fl.ctx.Done():
+		return false
+	case fl.out <- ev:
+		return true
+	}
+}
+
+// scan lists the live files of the source and starts following new ones.
+// Files present when the tail starts are read from their end, less backfill
+// lines; files that appear later are read from the start. A newer file of a
+// followed rotation family (app-2024-01-16.log after app-2024-01-15.log)
+// takes over from the older one.
+func (fl *follower) scan(initial bool, backfill int) error {
+	live, err := liveFiles(fl.source)
+	if err != nil {
+		return err
+	}
+
+	for _, lf := range live {
+		if _, ok := fl.files[lf.Path]; ok || parseRotationName(lf.Name).compressed {
+			continue
+		}
+		family := filepath.Join(filepath.Dir(lf.Path), lf.Family)
+
+		var previous *followedFile
+		for _, f := range fl.files {
+			if f.family == family {
+				previous = f
+				break
+			}
+		}
+		if previous == nil && len(fl.files) >= maxFollowFiles {
+			if !fl.limitHit {
+				log.Printf("[LOGS] Live tail limited to %d files of %s", maxFollowFiles, fl.source.Path)
+				fl.limitHit = true
+			}
+			continue
+		}
+
+		f := &followedFile{path: lf.Path, family: family, grouper: lineGrouper{rule: fl.rule}}
+		if initial {
+			// A missing file is opened from the start once it appears
+			f.open(backfill, true)
+		} else {
+			f.open(0, false)
+		}
+
+		from := ""
+		if previous != nil {
+			from = previous.path
+			if !fl.read(previous) || !fl.flush(previous) {
+				return nil
+			}
+			previous.close()
+			delete(fl.files, previous.path)
+		}
+		fl.files[f.path] = f
+		if !initial && (previous != nil || f.file != nil) && !fl.send(TailEvent{Kind: TailRotated, File: f.path, From: from}) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// open opens the file at path. With fromEnd it starts at the end of the file
+// less backfill lines, else at the start.
+func (f *followedFile) open(backfill int, fromEnd bool) bool {
+	file, err := os.Open(f.path)
+	if err != nil {
+		return false
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return false
+	}
+
+	var start int64
+	if fromEnd {
+		if start, err = backfillOffset(file, info.Size(), backfill); err != nil {
+			start = info.Size()
+		}
+		if _, err := file.Seek(start, io.SeekStart); err != nil {
+			file.Close()
+			return false
+		}
+	}
+	f.file, f.info = file, info
+	f.pending, f.pendingOffset = f.pending[:0], start
+	return true
+}
+
+func (f *followedFile) close() {
+	if f.file != nil {
+		f.file.Close()
+		f.file = nil
+	}
+}
+
+// poll reads what was appended to a file and checks whether it was replaced
+// or truncated. It returns false once ctx is cancelled.
+func (fl *follower) poll(f *followedFile) bool {
+	if f.file == nil {
+		// Waiting for the file to be created
+		if !f.open(0, false) {
+			return true
+		}
+		if !fl.send(TailEvent{Kind: TailRotated, File: f.path}) {
+			return false
+		}
+	}
+	if !fl.read(f) {
+		return false
+	}
+
+	info, err := os.Stat(f.path)
+	switch {
+	case err != nil:
+		// Moved away and not created again yet: keep reading the old file
+	case !os.SameFile(info, f.info):
+		// Replaced, as by logrotate's create: finish the old file first
+		if !fl.read(f) || !fl.flush(f) {
+			return false
+		}
+		f.close()
+		if !f.open(0, false) {
+			return true
+		}
+		if !fl.send(TailEvent{Kind: TailRotated, File: f.path, From: f.path}) {
+			return false
+		}
+		return fl.read(f)
+	case info.Size() < f.pendingOffset+int64(len(f.pending)):
+		// Truncated in place, as by copytruncate
+		if !fl.flush(f) {
+			return false
+		}
+		if _, err := f.file.Seek(0, io.SeekStart); err != nil {
+			return true
+		}
+		f.pending, f.pendingOffset = f.pending[:0], 0
+		if !fl.send(TailEvent{Kind: TailTruncated, File: f.path}) {
+			return false
+		}
+		return fl.read(f)
+	}
+
+	// Send a buffered multi-line event once no continuation followed
+	if f.grouper.hasPending() && time.Since(f.lastLine) >= multilineFlushDelay {
+		if ev, ok := f.grouper.flush(); ok {
+			return fl.send(TailEvent{Kind: TailLine, Text: ev.text, File: f.path, Offset: ev.offset})
+		}
+	}
+	return true
+}
+
+// read sends the complete lines appended to a file since the last read
+func (fl *follower) read(f *followedFile) bool {
+	buf := make([]byte, followChunk)
+	for {
+		n, err := f.file.Read(buf)
+		if n > 0 {
+			f.pending = append(f.pending, buf[:n]...)
+			if !fl.sendLines(f, false) {
+				return false
+			}
+		}
+		if err != nil || n == 0 {
+			return true
+		}
+	}
+}
+
+// sendLines sends the complete lines in f.pending, and with all also a last
+// line without a newline
+func (fl *follower) sendLines(f *followedFile, all bool) bool {
+	start := 0
+	for i := 0; i < len(f.pending); i++ {
+		if f.pending[i] != '\n' && i-start < maxFollowLine {
+			continue
+		}
+		if !fl.pushLine(f, f.pending[start:i], f.pendingOffset+int64(start)) {
+			return false
+		}
+		if f.pending[i] == '\n' {
+			start = i + 1
+		} else {
+			start = i
+		}
+	}
+	if all && start < len(f.pending) {
+		if !fl.pushLine(f, f.pending[start:], f.pendingOffset+int64(start)) {
+			return false
+		}
+		start = len(f.pending)
+	}
+	f.pendingOffset += int64(start)
+	f.pending = append(f.pending[:0], f.pending[start:]...)
+	return true
+}
+
+// pushLine passes one raw line through the multiline grouper
+func (fl *follower) pushLine(f *followedFile, line []byte, offset int64) bool {
+	if n := len(line); n > 0 && line[n-1] == '\r' {
+		line = line[:n-1]
+	}
+	f.lastLine = time.Now()
+	if ev, ok := f.grouper.push(string(line), 0, offset); ok {
+		return fl.send(TailEvent{Kind: TailLine, Text: ev.text, File: f.path, Offset: ev.offset})
+	}
+	return true
+}
+
+// flush sends everything still buffered for a file, before it is left
+func (fl *follower) flush(f *followedFile) bool {
+	if !fl.sendLines(f, true) {
+		return false
+	}
+	if ev, ok := f.grouper.flush(); ok {
+		return fl.send(TailEvent{Kind: TailLine, Text: ev.text, File: f.path, Offset: ev.offset})
+	}
+	return true
+}
+
+// backfillOffset returns where the last n lines of a file start, reading it
+// backwards from size
+func backfillOffset(f *os.File, size int64, n int) (int64, error) {
+	if n <= 0 || size == 0 {
+		return size, nil
+	}
+
+	// The newline ending the last line does not start another one
+	last := make([]byte, 1)
+	if _, err := f.ReadAt(last, size-1); err != nil {
+		return size, err
+	}
+	if last[0] == '\n' {
+		n++
+	}
+
+	buf := make([]byte, followChunk)
+	for end := size; end > 0; {
+		start := end - int64(len(buf))
+		if start < 0 {
+			start = 0
+		}
+		chunk := buf[:end-start]
+		if _, err := f.ReadAt(chunk, start); err != nil && err != io.EOF {
+			return size, err
+		}
+		for i := len(chunk) - 1; i >= 0; i-- {
+			if chunk[i] == '\n' {
+				if n--; n == 0 {
+					return start + int64(i) + 1, nil
+				}
+			}
+		}
+		end = start
+	}
+	return 0, nil
+}
@@ -0,0 +1,166 @@
+package logs
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Upper bound on files a glob or recursive directory may resolve to
+const maxDiscoveredFiles = 10000
+
+// IsGlob reports whether a configured path contains glob metacharacters
+func IsGlob(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
+
+// compileGlob turns a glob into an anchored regular expression. "*" and "?"
+// stay within one path segment, "**" spans any number of directories and
+// "[...]" is a character class ("[!...]" negates it).
+func compileGlob(pattern string) (*regexp.Regexp, error) {
+	pattern = filepath.ToSlash(pattern)
+
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				i++
+				// "**/" also matches no directory at all
+				if i+1 < len(pattern) && pattern[i+1] == '/' {
+					i++
+					b.WriteString("(?:.*/)?")
+				} else {
+					b.WriteString(".*")
+				}
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// globRoot returns the directory above the first segment with a metacharacter,
+// where walking for matches starts
+func globRoot(pattern string) string {
+	segments := strings.Split(filepath.ToSlash(pattern), "/")
+	for i, seg := range segments {
+		if IsGlob(seg) {
+			root := strings.Join(segments[:i], "/")
+			if root == "" && strings.HasPrefix(pattern, "/") {
+				return "/"
+			}
+			if root == "" {
+				return "."
+			}
+			return filepath.FromSlash(root)
+		}
+	}
+	return filepath.Dir(pattern)
+}
+
+// fileFilter applies the include and exclude patterns of a log source.
+// Patterns with a "/" match the path relative to the scanned directory,
+// others match the file name.
+type fileFilter struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+func newFileFilter(include, exclude []string) (*fileFilter, error) {
+	f := &fileFilter{}
+	for _, p := range include {
+		re, err := compileGlob(p)
+		if err != nil {
+			return nil, err
+		}
+		f.include = append(f.include, re)
+	}
+	for _, p := range exclude {
+		re, err := compileGlob(p)
+		if err != nil {
+			return nil, err
+		}
+		f.exclude = append(f.exclude, re)
+	}
+	return f, nil
+}
+
+// excluded reports whether a file matches an exclude pattern
+func (f *fileFilter) excluded(rel string) bool {
+	return matchAny(f.exclude, rel)
+}
+
+// included reports whether a file matches an include pattern, or true when
+// there are none
+func (f *fileFilter) included(rel string) bool {
+	return len(f.include) == 0 || matchAny(f.include, rel)
+}
+
+func matchAny(patterns []*regexp.Regexp, rel string) bool {
+	rel = filepath.ToSlash(rel)
+	name := rel[strings.LastIndexByte(rel, '/')+1:]
+	for _, re := range patterns {
+		if re.MatchString(name) || re.MatchString(rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// walkFiles calls visit with every regular file under root, or symlink to
+// one, and its path relative to root. Directories deeper than maxDepth are
+// not entered (0 lists root only, a negative depth has no limit). Unreadable
+// directories are skipped and the walk stops after maxDiscoveredFiles files.
+func walkFiles(root string, maxDepth int, visit func(path, rel string, info fs.FileInfo)) error {
+	count := 0
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			return nil
+		}
+		rel, _ := filepath.Rel(root, path)
+		if d.IsDir() {
+			if path != root && maxDepth >= 0 && strings.Count(filepath.ToSlash(rel), "/") >= maxDepth {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// Follow symlinks to files, as log directories often link the current file
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			return nil
+		}
+		if count >= maxDiscoveredFiles {
+			return filepath.SkipAll
+		}
+		count++
+		visit(path, rel, info)
+		return nil
+	})
+}
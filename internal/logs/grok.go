@@ -0,0 +1,131 @@
+package logs
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// grokPatterns is the built-in grok library, a subset of the common
+// Logstash patterns
+var grokPatterns = map[string]string{
+	"WORD":              `\b\w+\b`,
+	"NOTSPACE":          `\S+`,
+	"SPACE":             `\s*`,
+	"DATA":              `.*?`,
+	"GREEDYDATA":        `.*`,
+	"INT":               `[+-]?\d+`,
+	"POSINT":            `\b[1-9]\d*\b`,
+	"NONNEGINT":         `\b\d+\b`,
+	"NUMBER":            `[+-]?(?:\d+(?:\.\d*)?|\.\d+)`,
+	"BASE16NUM":         `(?:0[xX])?[0-9A-Fa-f]+`,
+	"UUID":              `[A-Fa-f0-9]{8}-(?:[A-Fa-f0-9]{4}-){3}[A-Fa-f0-9]{12}`,
+	"USERNAME":          `[a-zA-Z0-9._-]+`,
+	"USER":              `%{USERNAME}`,
+	"IPV4":              `(?:\d{1,3}\.){3}\d{1,3}`,
+	"IPV6":              `[0-9A-Fa-f:]*:[0-9A-Fa-f:.]+`,
+	"IP":                `(?:%{IPV6}|%{IPV4})`,
+	"HOSTNAME":          `\b[0-9A-Za-z][0-9A-Za-z-]{0,62}(?:\.[0-9A-Za-z][0-9A-Za-z-]{0,62})*\.?\b`,
+	"IPORHOST":          `(?:%{IP}|%{HOSTNAME})`,
+	"HOSTPORT":          `%{IPORHOST}:%{POSINT}`,
+	"PATH":              `(?:/[^\s]*)+`,
+	"URIPATHPARAM":      `/[^\s?#]*(?:\?[^\s#]*)?`,
+	"URI":               `[A-Za-z][A-Za-z0-9+.-]*://\S+`,
+	"QUOTEDSTRING":      `"(?:[^"\\]|\\.)*"`,
+	"LOGLEVEL":          `(?i:trace|debug|info|notice|warn(?:ing)?|err(?:or)?|crit(?:ical)?|fatal|severe|emerg(?:ency)?|alert)`,
+	"MONTH":             `\b(?:Jan(?:uary)?|Feb(?:ruary)?|Mar(?:ch)?|Apr(?:il)?|May|June?|July?|Aug(?:ust)?|Sep(?:tember)?|Oct(?:ober)?|Nov(?:ember)?|Dec(?:ember)?)\b`,
+	"MONTHNUM":          `(?:0?[1-9]|1[0-2])`,
+	"MONTHDAY":          `(?:(?:0[1-9])|(?:[12][0-9])|(?:3[01])|[1-9])`,
+	"DAY":               `(?:Mon(?:day)?|Tue(?:sday)?|Wed(?:nesday)?|Thu(?:rsday)?|Fri(?:day)?|Sat(?:urday)?|Sun(?:day)?)`,
+	"YEAR":              `\d{4}`,
+	"HOUR":              `(?:2[0123]|[01]?[0-9])`,
+	"MINUTE":            `[0-5][0-9]`,
+	"SECOND":            `(?:[0-5]?[0-9]|60)(?:[:.,][0-9]+)?`,
+	"TIME":              `%{HOUR}:%{MINUTE}(?::%{SECOND})?`,
+	"ISO8601_TIMEZONE":  `(?:Z|[+-]%{HOUR}(?::?%{MINUTE}))`,
+	"TIMESTAMP_ISO8601": `%{YEAR}-%{MONTHNUM}-%{MONTHDAY}[T ]%{HOUR}:?%{MINUTE}(?::?%{SECOND})?%{ISO8601_TIMEZONE}?`,
+	"DATE_US":           `%{MONTHNUM}[/-]%{MONTHDAY}[/-]%{YEAR}`,
+	"DATE_EU":           `%{MONTHDAY}[./-]%{MONTHNUM}[./-]%{YEAR}`,
+	"HTTPDATE":          `%{MONTHDAY}/%{MONTH}/%{YEAR}:%{TIME} [+-]\d{4}`,
+	"SYSLOGTIMESTAMP":   `%{MONTH} +%{MONTHDAY} %{TIME}`,
+	"PROG":              `[\x21-\x5a\x5c\x5e-\x7e]+`,
+	"SYSLOGPROG":        `%{PROG:program}(?:\[%{POSINT:pid}\])?`,
+}
+
+// Matches %{NAME} and %{NAME:field}
+var grokRefRegex = regexp.MustCompile(`%\{(\w+)(?::([\w.@-]+))?\}`)
+
+// maxGrokDepth bounds nested pattern references to catch definition cycles
+const maxGrokDepth = 16
+
+// compileGrok expands a grok expression into a regular expression. Named
+// references become capture groups; the returned names map each group name
+// used in the regex to the field it was declared as, since field names may
+// contain characters that Go does not allow in group names.
+func compileGrok(expr string, custom map[string]string) (*regexp.Regexp, map[string]string, error) {
+	names := make(map[string]string)
+	expanded, err := expandGrok(expr, custom, names, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	re, err := regexp.Compile(expanded)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid grok pattern: %w", err)
+	}
+	return re, names, nil
+}
+
+func expandGrok(expr string, custom map[string]string, names map[string]string, depth int) (string, error) {
+	if depth > maxGrokDepth {
+		return "", fmt.Errorf("grok patterns nested too deeply (cycle?)")
+	}
+
+	var firstErr error
+	out := grokRefRegex.ReplaceAllStringFunc(expr, func(ref string) string {
+		m := grokRefRegex.FindStringSubmatch(ref)
+		name, field := m[1], m[2]
+
+		def, ok := custom[name]
+		if !ok {
+			def, ok = grokPatterns[name]
+		}
+		if !ok {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("unknown grok pattern %q", name)
+			}
+			return ref
+		}
+
+		inner, err := expandGrok(def, custom, names, depth+1)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			return ref
+		}
+		if field == "" {
+			return "(?:" + inner + ")"
+		}
+		group := fmt.Sprintf("g%d", len(names))
+		names[group] = field
+		return "(?P<" + group + ">" + inner + ")"
+	})
+	if firstErr != nil {
+		return "", firstErr
+	}
+	return out, nil
+}
+
+// groupFields returns the field name of every capture group of re, or ""
+// for unnamed groups. names maps group names to field names (grok).
+func groupFields(re *regexp.Regexp, names map[string]string) []string {
+	fields := re.SubexpNames()
+	out := make([]string, len(fields))
+	for i, name := range fields {
+		if field, ok := names[name]; ok {
+			name = field
+		}
+		out[i] = strings.TrimSpace(name)
+	}
+	return out
+}
@@ -0,0 +1,208 @@
+package logs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+const (
+	histogramTimeout     = 30 * time.Second // Histograms read every matching file in full
+	maxHistogramBuckets  = 10000
+	autoHistogramBuckets = 100 // Upper bound on buckets when the interval is picked automatically
+)
+
+// Intervals tried, smallest first, when no interval is requested
+var histogramIntervals = []time.Duration{
+	time.Second, 5 * time.Second, 10 * time.Second, 30 * time.Second,
+	time.Minute, 5 * time.Minute, 10 * time.Minute, 30 * time.Minute,
+	time.Hour, 3 * time.Hour, 6 * time.Hour, 12 * time.Hour,
+	24 * time.Hour, 7 * 24 * time.Hour, 30 * 24 * time.Hour,
+}
+
+// HistogramBucket counts the matching events that start in [Time, Time+interval)
+type HistogramBucket struct {
+	Time   time.Time      `json:"time"`
+	Total  int            `json:"total"`
+	Levels map[string]int `json:"levels"`
+}
+
+// Histogram is the event volume of a search over time
+type Histogram struct {
+	Interval        string            `json:"interval"`
+	IntervalSeconds float64           `json:"interval_seconds"`
+	Buckets         []HistogramBucket `json:"buckets"`
+	Total           int               `json:"total"`
+	Untimed         int               `json:"untimed"` // Matches without a timestamp, not in any bucket
+	FilesScanned    int               `json:"files_scanned"`
+	FilesTotal      int               `json:"files_total"`
+	TimedOut        bool              `json:"timed_out"`
+}
+
+// SearchHistogram counts the events matching opts per time bucket and level
+// across all rotated and archived files. Limit and Cursor are ignored. A zero
+// interval picks one that gives at most 100 buckets.
+func SearchHistogram(ctx context.Context, opts SearchOptions, interval time.Duration) (Histogram, error) {
+	hist := Histogram{Buckets: []HistogramBucket{}}
+
+	query, err := CompileQuery(opts)
+	if err != nil {
+		return hist, err
+	}
+
+	targets, err := resolveTargets(opts)
+	if err != nil {
+		return hist, err
+	}
+	hist.FilesTotal = len(targets)
+
+	// Without a requested interval, pick one for the time window or the span
+	// of the files, and widen it should matches lie outside that span
+	auto := interval <= 0
+	first, last := histogramSpan(opts, targets)
+	if auto {
+		interval = pickInterval(first, last)
+	}
+
+	budget, cancel := context.WithTimeout(ctx, histogramTimeout)
+	defer cancel()
+	// A requested interval too small for the data stops the scan early
+	scan, stop := context.WithCancel(budget)
+	defer stop()
+
+	counts := make(map[int64]*HistogramBucket)
+	for _, target := range targets {
+		err := walkFile(scan, target, query, opts, 0, func(hit searchHit, hasTimestamp bool) {
+			if !hasTimestamp {
+				hist.Untimed++
+				return
+			}
+			ts := hit.result.Timestamp
+			if auto && (first.IsZero() || ts.Before(first) || ts.After(last)) {
+				if first.IsZero() || ts.Before(first) {
+					first = ts
+				}
+				if last.IsZero() || ts.After(last) {
+					last = ts
+				}
+				if wider := pickInterval(first, last); wider > interval {
+					interval = wider
+					counts = regroup(counts, interval)
+				}
+			}
+			addToBucket(counts, ts.Truncate(interval), hit.result.Level, 1)
+			if len(counts) > maxHistogramBuckets {
+				stop()
+			}
+		})
+		if len(counts) > maxHistogramBuckets {
+			return hist, fmt.Errorf("interval %s gives more than %d buckets", interval, maxHistogramBuckets)
+		}
+		if err != nil && budget.Err() != nil {
+			if ctx.Err() != nil {
+				return hist, ctx.Err()
+			}
+			log.Printf("[LOGS] Histogram timeout after %s, returning partial counts", histogramTimeout)
+			hist.TimedOut = true
+			break
+		}
+		hist.FilesScanned++
+		if err != nil {
+			log.Printf("[LOGS] Failed to search %s: %v", target.Path, err)
+		}
+	}
+
+	hist.Interval = interval.String()
+	hist.IntervalSeconds = interval.Seconds()
+	if len(counts) == 0 && (opts.From.IsZero() || opts.To.IsZero()) {
+		return hist, nil
+	}
+
+	// Zero-fill between the first and last bucket (or the requested range)
+	first, last = time.Time{}, time.Time{}
+	if len(counts) > 0 {
+		keys := make([]int64, 0, len(counts))
+		for k := range counts {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+		first = time.Unix(0, keys[0]).UTC()
+		last = time.Unix(0, keys[len(keys)-1]).UTC()
+	}
+	if !opts.From.IsZero() {
+		first = opts.From.UTC().Truncate(interval)
+	}
+	if !opts.To.IsZero() {
+		last = opts.To.UTC().Truncate(interval)
+	}
+	if n := int(last.Sub(first)/interval) + 1; n > maxHistogramBuckets {
+		return hist, fmt.Errorf("interval %s gives %d buckets, the maximum is %d", interval, n, maxHistogramBuckets)
+	}
+
+	for t := first; !t.After(last); t = t.Add(interval) {
+		bucket := HistogramBucket{Time: t, Levels: map[string]int{}}
+		if b, ok := counts[t.UnixNano()]; ok {
+			bucket = *b
+		}
+		hist.Total += bucket.Total
+		hist.Buckets = append(hist.Buckets, bucket)
+	}
+	return hist, nil
+}
+
+// addToBucket adds n events of a level to the bucket starting at t
+func addToBucket(counts map[int64]*HistogramBucket, t time.Time, level string, n int) {
+	t = t.UTC()
+	b, ok := counts[t.UnixNano()]
+	if !ok {
+		b = &HistogramBucket{Time: t, Levels: map[string]int{}}
+		counts[t.UnixNano()] = b
+	}
+	b.Total += n
+	b.Levels[level] += n
+}
+
+// histogramSpan returns the time a histogram covers as far as is known
+// before reading: the requested range, else the span of the files. Either
+// end is zero when unknown.
+func histogramSpan(opts SearchOptions, targets []searchTarget) (first, last time.Time) {
+	first, last = opts.From, opts.To
+	for _, t := range targets {
+		if opts.From.IsZero() && !t.Start.IsZero() && (first.IsZero() || t.Start.Before(first)) {
+			first = t.Start
+		}
+		if opts.To.IsZero() && t.End.After(last) {
+			last = t.End
+		}
+	}
+	return first, last
+}
+
+// pickInterval returns the smallest standard interval that covers the span
+// from first to last in at most autoHistogramBuckets
+func pickInterval(first, last time.Time) time.Duration {
+	if first.IsZero() || last.IsZero() {
+		return histogramIntervals[0]
+	}
+	span := last.Sub(first)
+	for _, iv := range histogramIntervals {
+		if span/iv < autoHistogramBuckets {
+			return iv
+		}
+	}
+	return histogramIntervals[len(histogramIntervals)-1]
+}
+
+// regroup merges buckets into buckets of a wider interval
+func regroup(counts map[int64]*HistogramBucket, interval time.Duration) map[int64]*HistogramBucket {
+	out := make(map[int64]*HistogramBucket)
+	for _, b := range counts {
+		t := b.Time.Truncate(interval)
+		for level, n := range b.Levels {
+			addToBucket(out, t, level, n)
+		}
+	}
+	return out
+}
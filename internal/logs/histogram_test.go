@@ -0,0 +1,59 @@
+package logs
+
+import (
+	"context"
+	"fmt"
+	"logmojo/internal/config"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSearchHistogram(t *testing.T) {
+	// One event a day for a year, at a different second each day
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var lines []string
+	for day := 0; day < 366; day++ {
+		ts := start.AddDate(0, 0, day).Add(time.Duration(day*37) * time.Second)
+		lines = append(lines, fmt.Sprintf("%s ERROR failed", ts.Format(time.RFC3339)))
+	}
+	useFileApp(t, config.LogConfig{}, lines...)
+	// Written when the last event was logged
+	end := start.AddDate(0, 0, 366)
+	if err := os.Chtimes(config.AppConfigData.Apps[0].Logs[0].Path, end, end); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		opts     SearchOptions
+		interval time.Duration
+		want     time.Duration
+		total    int
+	}{
+		{"whole file", SearchOptions{}, 0, 7 * 24 * time.Hour, 366},
+		{"requested window", SearchOptions{From: start, To: start.Add(48 * time.Hour)}, 0, 30 * time.Minute, 2},
+		{"requested interval", SearchOptions{}, 24 * time.Hour, 24 * time.Hour, 366},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.App = "shop"
+			hist, err := SearchHistogram(context.Background(), tt.opts, tt.interval)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hist.IntervalSeconds != tt.want.Seconds() || hist.Total != tt.total {
+				t.Errorf("interval %s, total %d; want %s, %d", hist.Interval, hist.Total, tt.want, tt.total)
+			}
+			if tt.interval == 0 && len(hist.Buckets) > autoHistogramBuckets {
+				t.Errorf("%d buckets", len(hist.Buckets))
+			}
+		})
+	}
+
+	_, err := SearchHistogram(context.Background(), SearchOptions{App: "shop"}, time.Second)
+	if err == nil || !strings.Contains(err.Error(), "buckets") {
+		t.Errorf("1s buckets over a year: got %v", err)
+	}
+}
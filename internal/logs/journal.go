@@ -0,0 +1,215 @@
+package logs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"logmojo/internal/config"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Prefix of the virtual file path of journal sources, e.g. "journal:nginx"
+const journalPathPrefix = "journal:"
+
+// Journal fields kept as structured fields, by the name they are given
+var journalFields = map[string]string{
+	"_SYSTEMD_UNIT":     "unit",
+	"SYSLOG_IDENTIFIER": "identifier",
+	"_PID":              "pid",
+	"_HOSTNAME":         "host",
+	"_COMM":             "comm",
+	"_TRANSPORT":        "transport",
+	"CODE_FILE":         "code_file",
+	"CODE_LINE":         "code_line",
+	"CODE_FUNC":         "code_func",
+	"ERRNO":             "errno",
+}
+
+// syslog priorities 0 (emerg) to 7 (debug)
+var journalLevels = []string{"FATAL", "FATAL", "FATAL", "ERROR", "WARN", "INFO", "INFO", "DEBUG"}
+
+// IsJournal reports whether a log source reads the systemd journal
+func IsJournal(cfg config.LogConfig) bool {
+	return strings.EqualFold(cfg.Type, "journal")
+}
+
+// IsJournalPath reports whether path is the virtual file of a journal source
+func IsJournalPath(path string) bool {
+	return strings.HasPrefix(path, journalPathPrefix)
+}
+
+// journalFile is the single virtual file of a journal source
+func journalFile(cfg config.LogConfig) LogFile {
+	now := time.Now()
+	name := "journal"
+	if cfg.Unit != "" {
+		name = "journal (" + cfg.Unit + ")"
+	}
+	return LogFile{
+		Name:    name,
+		Path:    journalPathPrefix + cfg.Unit,
+		ModTime: now,
+		Family:  "journal",
+		End:     now,
+	}
+}
+
+// journalArgs builds the journalctl command line for a source. Path, if set,
+// is a journal directory (journalctl --directory), e.g. one copied from
+// another machine. A follow starts with the last backfill entries.
+func journalArgs(cfg config.LogConfig, since, until time.Time, follow bool, backfill int) []string {
+	args := []string{"--output=json", "--no-pager", "--quiet"}
+	if cfg.Unit != "" {
+		args = append(args, "--unit="+cfg.Unit)
+	}
+	if cfg.Path != "" {
+		args = append(args, "--directory="+cfg.Path)
+	}
+	if !since.IsZero() {
+		args = append(args, fmt.Sprintf("--since=@%d", since.Unix()))
+	}
+	if !until.IsZero() {
+		args = append(args, fmt.Sprintf("--until=@%d", until.Unix()+1))
+	}
+	if follow {
+		args = append(args, "--follow", "--lines="+strconv.Itoa(backfill))
+	}
+	return args
+}
+
+// journalReader streams journalctl output and stops the process on Close
+type journalReader struct {
+	io.ReadCloser
+	cmd    *exec.Cmd
+	stderr bytes.Buffer
+}
+
+// Close stops journalctl. It returns journalctl's error only if it failed on
+// its own, e.g. for a unit or directory it cannot read.
+func (r *journalReader) Close() error {
+	r.ReadCloser.Close()
+	r.cmd.Process.Kill()
+	r.cmd.Wait()
+	if state := r.cmd.ProcessState; state != nil && state.Exited() && !state.Success() {
+		return fmt.Errorf("journalctl: %s", strings.TrimSpace(r.stderr.String()))
+	}
+	return nil
+}
+
+// openJournal starts journalctl for a source and returns its JSON output,
+// one entry per line, oldest first
+func openJournal(ctx context.Context, cfg config.LogConfig, since, until time.Time, follow bool, backfill int) (io.ReadCloser, error) {
+	r := &journalReader{cmd: exec.CommandContext(ctx, "journalctl", journalArgs(cfg, since, until, follow, backfill)...)}
+	r.cmd.Stderr = &r.stderr
+	stdout, err := r.cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("journalctl: %w", err)
+	}
+	r.ReadCloser = stdout
+	return r, nil
+}
+
+// followJournal sends the last backfill and then new journal entries of a
+// source to out, one JSON line each, until ctx is cancelled
+func followJournal(ctx context.Context, cfg config.LogConfig, backfill int, out chan<- TailEvent) error {
+	rc, err := openJournal(ctx, cfg, time.Time{}, time.Time{}, true, backfill)
+	if err != nil {
+		return err
+	}
+
+	path := journalFile(cfg).Path
+	scanner := bufio.NewScanner(rc)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		select {
+		case <-ctx.Done():
+			rc.Close()
+			return nil
+		case out <- TailEvent{Kind: TailLine, Text: scanner.Text(), File: path}:
+		}
+	}
+	if err := rc.Close(); err != nil && ctx.Err() == nil {
+		return err
+	}
+	return scanner.Err()
+}
+
+// parseJournalEntry turns one line of `journalctl -o json` into a structured
+// entry: PRIORITY gives the level, __REALTIME_TIMESTAMP (microseconds) the
+// time, and unit, identifier, pid and a few other fields are kept
+func parseJournalEntry(line string) (structuredEntry, bool) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(line), &raw); err != nil {
+		return structuredEntry{}, false
+	}
+
+	entry := structuredEntry{fields: make(map[string]string)}
+	for key, value := range raw {
+		v, ok := journalValue(value)
+		if !ok {
+			continue
+		}
+		switch key {
+		case "MESSAGE":
+			entry.message = v
+		case "PRIORITY":
+			if p, err := strconv.Atoi(v); err == nil && p >= 0 && p < len(journalLevels) {
+				entry.level = journalLevels[p]
+			}
+		case "__REALTIME_TIMESTAMP":
+			if us, err := strconv.ParseInt(v, 10, 64); err == nil {
+				entry.timestamp = time.UnixMicro(us)
+			}
+		default:
+			if name, ok := journalFields[key]; ok {
+				entry.fields[name] = v
+			}
+		}
+	}
+	if _, ok := raw["MESSAGE"]; !ok && entry.timestamp.IsZero() {
+		return structuredEntry{}, false
+	}
+	return entry, true
+}
+
+// journalMessage returns the MESSAGE of one line of `journalctl -o json`
+func journalMessage(line string) (string, bool) {
+	var entry struct {
+		Message json.RawMessage `json:"MESSAGE"`
+	}
+	if err := json.Unmarshal([]byte(line), &entry); err != nil || entry.Message == nil {
+		return "", false
+	}
+	return journalValue(entry.Message)
+}
+
+// journalValue decodes a journal field. Fields are strings, or arrays of
+// bytes when they are not valid UTF-8; repeated fields are arrays of those.
+func journalValue(raw json.RawMessage) (string, bool) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s, true
+	}
+	var b []byte
+	var ints []int
+	if err := json.Unmarshal(raw, &ints); err == nil {
+		for _, i := range ints {
+			b = append(b, byte(i))
+		}
+		return strings.ToValidUTF8(string(b), "�"), true
+	}
+	var values []json.RawMessage
+	if err := json.Unmarshal(raw, &values); err == nil && len(values) > 0 {
+		return journalValue(values[len(values)-1])
+	}
+	return "", false
+}
@@ -0,0 +1,194 @@
+package logs
+
+import (
+	"bufio"
+	"context"
+	"logmojo/internal/config"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// journalFixture returns the lines of a recorded `journalctl -o json` output
+func journalFixture(t *testing.T) []string {
+	t.Helper()
+	f, err := os.Open("testdata/journal/nginx.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines
+}
+
+// fakeJournalctl puts a journalctl on PATH that prints the recorded fixture
+// from --since on
+func fakeJournalctl(t *testing.T) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a shell script on PATH")
+	}
+	fixture, err := filepath.Abs("testdata/journal/nginx.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	script := `#!/bin/sh
+since=0
+for arg; do
+	case "$arg" in --since=@*) since=${arg#--since=@} ;; esac
+done
+awk -v since="$since" 'match($0, /"__REALTIME_TIMESTAMP":"[0-9]+"/) {
+	if (substr($0, RSTART+24, RLENGTH-25) / 1000000 >= since) print
+}' '` + fixture + "'\n"
+	if err := os.WriteFile(filepath.Join(dir, "journalctl"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestParseJournalEntry(t *testing.T) {
+	lines := journalFixture(t)
+	tests := []struct {
+		line    int
+		level   string
+		time    time.Time
+		message string
+		fields  map[string]string
+	}{
+		{0, "INFO", time.UnixMicro(1705312800123456), "Starting A high performance web server and a reverse proxy server...",
+			map[string]string{"unit": "init.scope", "identifier": "systemd", "pid": "1", "host": "web-01", "comm": "systemd", "transport": "journal"}},
+		{1, "ERROR", time.UnixMicro(1705312800200000), "nginx: [emerg] bind() to 0.0.0.0:80 failed (98: Address already in use)",
+			map[string]string{"unit": "nginx.service", "identifier": "nginx", "pid": "4211", "host": "web-01", "comm": "nginx", "transport": "stdout"}},
+		{2, "WARN", time.UnixMicro(1705312805000000), "nginx: upstream timed out�",
+			map[string]string{"unit": "nginx.service", "identifier": "nginx", "pid": "4233", "host": "web-01", "comm": "nginx", "transport": "stdout"}},
+		{3, "DEBUG", time.UnixMicro(1705312810000000), "close http connection: 17",
+			map[string]string{"unit": "nginx.service", "identifier": "nginx", "pid": "4233", "host": "web-01", "comm": "nginx", "transport": "journal",
+				"code_file": "src/http/ngx_http_request.c", "code_line": "3712", "code_func": "ngx_http_close_connection"}},
+	}
+	for _, tt := range tests {
+		entry, ok := parseJournalEntry(lines[tt.line])
+		if !ok {
+			t.Errorf("line %d: not parsed", tt.line)
+			continue
+		}
+		if entry.level != tt.level || !entry.timestamp.Equal(tt.time) || entry.message != tt.message {
+			t.Errorf("line %d: got %s %s %q", tt.line, entry.level, entry.timestamp, entry.message)
+		}
+		if !reflect.DeepEqual(entry.fields, tt.fields) {
+			t.Errorf("line %d: fields = %v, want %v", tt.line, entry.fields, tt.fields)
+		}
+	}
+
+	if _, ok := parseJournalEntry("not json"); ok {
+		t.Error("parsed a line that is not JSON")
+	}
+}
+
+func TestJournalArgs(t *testing.T) {
+	cfg := config.LogConfig{Type: "journal", Unit: "nginx", Path: "/mnt/journal"}
+	since := time.Unix(1705312800, 0)
+	until := time.Unix(1705313700, 0)
+
+	got := strings.Join(journalArgs(cfg, since, until, false, 0), " ")
+	want := "--output=json --no-pager --quiet --unit=nginx --directory=/mnt/journal --since=@1705312800 --until=@1705313701"
+	if got != want {
+		t.Errorf("journalArgs = %q, want %q", got, want)
+	}
+
+	got = strings.Join(journalArgs(config.LogConfig{Type: "journal"}, time.Time{}, time.Time{}, true, 20), " ")
+	if want := "--output=json --no-pager --quiet --follow --lines=20"; got != want {
+		t.Errorf("journalArgs = %q, want %q", got, want)
+	}
+}
+
+func TestSearchJournalMatchesMessage(t *testing.T) {
+	fakeJournalctl(t)
+	saved := config.AppConfigData
+	t.Cleanup(func() { config.AppConfigData = saved })
+	config.AppConfigData = config.Config{Apps: []config.AppConfig{{
+		Name: "nginx",
+		Logs: []config.LogConfig{{Name: "journal", Type: "journal", Unit: "nginx"}},
+	}}}
+
+	tests := []struct {
+		name  string
+		opts  SearchOptions
+		count int
+	}{
+		{"all entries", SearchOptions{}, 4},
+		{"metadata keys do not match", SearchOptions{Query: "_SYSTEMD_UNIT OR __CURSOR OR PRIORITY OR web-01"}, 0},
+		{"message text", SearchOptions{Query: `"Address already in use"`}, 1},
+		{"byte array message", SearchOptions{Query: "upstream"}, 1},
+		{"anchored regex sees the message", SearchOptions{Query: "^nginx:", Regex: true}, 2},
+		{"unit field", SearchOptions{Query: "unit:nginx.service"}, 3},
+		{"level from priority", SearchOptions{Level: "ERROR"}, 1},
+		{"time range", SearchOptions{From: time.UnixMicro(1705312801000000), To: time.UnixMicro(1705312806000000)}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.App = "nginx"
+			page, err := Search(context.Background(), tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(page.Results) != tt.count {
+				t.Errorf("got %d results, want %d: %+v", len(page.Results), tt.count, page.Results)
+			}
+		})
+	}
+}
+
+func TestSearchJournalPagesKeepTheirWindow(t *testing.T) {
+	fakeJournalctl(t)
+	saved := config.AppConfigData
+	t.Cleanup(func() { config.AppConfigData = saved })
+	config.AppConfigData = config.Config{Apps: []config.AppConfig{{
+		Name: "nginx",
+		Logs: []config.LogConfig{{Name: "journal", Type: "journal", Unit: "nginx"}},
+	}}}
+
+	var messages []string
+	opts := SearchOptions{App: "nginx", Limit: 1, From: time.Unix(1705312800, 0)}
+	for {
+		page, err := Search(context.Background(), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range page.Results {
+			messages = append(messages, r.Message)
+		}
+		if page.Next == "" || len(messages) > 4 {
+			break
+		}
+		// A relative from such as now-1h resolves later on every page
+		opts.Cursor = page.Next
+		opts.From = opts.From.Add(3 * time.Second)
+	}
+
+	want := []string{
+		"close http connection: 17",
+		"nginx: upstream timed out\ufffd",
+		"nginx: [emerg] bind() to 0.0.0.0:80 failed (98: Address already in use)",
+		"Starting A high performance web server and a reverse proxy server...",
+	}
+	if !reflect.DeepEqual(messages, want) {
+		t.Errorf("pages gave %q, want %q", messages, want)
+	}
+}
+
+func TestJournalContext(t *testing.T) {
+	// Refused before journalctl or a file of that name is looked for
+	_, err := Context(journalFile(config.LogConfig{Type: "journal", Unit: "nginx"}).Path, ContextOptions{Line: 3, Before: 5, After: 5})
+	if err != errJournalContext {
+		t.Errorf("got %v, want %v", err, errJournalContext)
+	}
+}
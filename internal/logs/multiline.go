@@ -0,0 +1,113 @@
+package logs
+
+import (
+	"fmt"
+	"logmojo/internal/config"
+	"regexp"
+	"strings"
+)
+
+const defaultMultilineMaxLines = 500
+
+// Lines that begin with a timestamp start a new event in "timestamp" mode
+var leadingTimestampRegex = regexp.MustCompile(`^\s*\[?(?:\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}|\d{1,2}/\d{1,2}/\d{4}|\d{1,2}\.\d{1,2}\.\d{4}|\d{1,2}/\w{3}/\d{4}:\d{2}|\w{3}\s+\d{1,2}\s+\d{2}:\d{2}|\w{3}\s+\w{3}\s+\d{1,2}\s+\d{2}:\d{2}|\d{2}:\d{2}:\d{2}|1\d{9})`)
+
+// multilineRule decides which raw lines start a new event
+type multilineRule struct {
+	isStart  func(line string) bool
+	maxLines int
+}
+
+// compileMultiline builds the grouping rule of a log source. A nil rule
+// means every line is its own event.
+func compileMultiline(cfg config.MultilineConfig) (*multilineRule, error) {
+	rule := &multilineRule{maxLines: cfg.MaxLines}
+	if rule.maxLines <= 0 {
+		rule.maxLines = defaultMultilineMaxLines
+	}
+
+	switch cfg.Mode {
+	case "":
+		return nil, nil
+	case "timestamp":
+		rule.isStart = leadingTimestampRegex.MatchString
+	case "continuation", "start":
+		if cfg.Pattern == "" {
+			return nil, fmt.Errorf("multiline mode %q requires a pattern", cfg.Mode)
+		}
+		re, err := regexp.Compile(cfg.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid multiline pattern: %w", err)
+		}
+		if cfg.Mode == "start" {
+			rule.isStart = re.MatchString
+		} else {
+			rule.isStart = func(line string) bool { return !re.MatchString(line) }
+		}
+	default:
+		return nil, fmt.Errorf("unknown multiline mode %q", cfg.Mode)
+	}
+	return rule, nil
+}
+
+// sourceMultiline builds the grouping rule of a log source. Lines wrapped by
+// the source (Docker json-file, journal JSON) are judged by what the
+// application wrote.
+func sourceMultiline(cfg config.LogConfig, parser *Parser) (*multilineRule, error) {
+	rule, err := compileMultiline(cfg.Multiline)
+	if rule == nil || err != nil || !parser.wrapped() {
+		return rule, err
+	}
+	isStart := rule.isStart
+	rule.isStart = func(line string) bool { return isStart(parser.linePayload(line)) }
+	return rule, nil
+}
+
+// logEvent is one logical log entry made of one or more raw lines
+type logEvent struct {
+	text   string
+	line   int   // 1-based line number of the first raw line
+	offset int64 // Byte offset of the first raw line in the (decompressed) file
+}
+
+// lineGrouper folds continuation lines into the event that precedes them
+type lineGrouper struct {
+	rule        *multilineRule
+	pending     []string
+	start       int
+	startOffset int64
+}
+
+// push adds a raw line and returns the previous event if this line completes it
+func (g *lineGrouper) push(line string, lineNo int, offset int64) (logEvent, bool) {
+	if g.rule == nil {
+		return logEvent{text: line, line: lineNo, offset: offset}, true
+	}
+
+	// Continuation lines before the first event start are kept as their own event
+	if len(g.pending) > 0 && !g.rule.isStart(line) && len(g.pending) < g.rule.maxLines {
+		g.pending = append(g.pending, line)
+		return logEvent{}, false
+	}
+
+	event, ok := g.flush()
+	g.pending = append(g.pending, line)
+	g.start = lineNo
+	g.startOffset = offset
+	return event, ok
+}
+
+// flush returns the buffered event, if any
+func (g *lineGrouper) flush() (logEvent, bool) {
+	if len(g.pending) == 0 {
+		return logEvent{}, false
+	}
+	event := logEvent{text: strings.Join(g.pending, "\n"), line: g.start, offset: g.startOffset}
+	g.pending = g.pending[:0]
+	return event, true
+}
+
+// hasPending reports whether an incomplete event is buffered
+func (g *lineGrouper) hasPending() bool {
+	return len(g.pending) > 0
+}
@@ -0,0 +1,262 @@
+package logs
+
+import (
+	"fmt"
+	"logmojo/internal/config"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Parser turns raw events of one log source into LogResults. Sources with a
+// custom parser block use it; other lines fall back to JSON/logfmt detection
+// and the built-in level and timestamp heuristics.
+type Parser struct {
+	format string // "plain", "json", "logfmt", "auto" or "journal"
+	custom *customParser
+	docker bool // Lines are wrapped by Docker's json-file driver
+}
+
+// customParser is the compiled parser block of a log source
+type customParser struct {
+	re       *regexp.Regexp
+	fields   []string // Field name of each capture group
+	layout   string
+	location *time.Location
+}
+
+// NewParser builds the parser for a configured log source
+func NewParser(cfg config.LogConfig) (*Parser, error) {
+	format := strings.ToLower(cfg.Format)
+	switch {
+	case IsJournal(cfg):
+		format = "journal" // journalctl JSON, whatever the source says
+	case format == "":
+		format = "auto"
+	case format == "plain", format == "json", format == "logfmt", format == "auto":
+	default:
+		return nil, fmt.Errorf("unknown log format %q", cfg.Format)
+	}
+
+	p := &Parser{format: format, docker: IsDocker(cfg)}
+	if cfg.Parser != nil {
+		custom, err := compileCustomParser(*cfg.Parser)
+		if err != nil {
+			return nil, err
+		}
+		p.custom = custom
+	}
+	return p, nil
+}
+
+func compileCustomParser(cfg config.ParserConfig) (*customParser, error) {
+	var re *regexp.Regexp
+	var names map[string]string
+	var err error
+
+	switch {
+	case cfg.Pattern != "" && cfg.Grok != "":
+		return nil, fmt.Errorf("parser: set either pattern or grok, not both")
+	case cfg.Pattern != "":
+		if re, err = regexp.Compile(cfg.Pattern); err != nil {
+			return nil, fmt.Errorf("parser: invalid pattern: %w", err)
+		}
+	case cfg.Grok != "":
+		if re, names, err = compileGrok(cfg.Grok, cfg.Patterns); err != nil {
+			return nil, fmt.Errorf("parser: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("parser: pattern or grok is required")
+	}
+
+	location := time.UTC
+	if cfg.Timezone != "" {
+		if location, err = time.LoadLocation(cfg.Timezone); err != nil {
+			return nil, fmt.Errorf("parser: invalid timezone: %w", err)
+		}
+	}
+
+	return &customParser{
+		re:       re,
+		fields:   groupFields(re, names),
+		layout:   cfg.TimestampLayout,
+		location: location,
+	}, nil
+}
+
+// Parse parses a raw line or multi-line event into a LogResult and reports
+// whether a real timestamp was found. Level and timestamp come from the first
+// line; continuation lines are kept verbatim in the message.
+func (p *Parser) Parse(appName, path, content string) (LogResult, bool) {
+	if p.docker {
+		return p.parseDocker(appName, path, content)
+	}
+	return p.parseEvent(appName, path, content)
+}
+
+// wrapped reports whether raw lines wrap what the application wrote, as
+// Docker's json-file driver and journalctl's JSON output do
+func (p *Parser) wrapped() bool {
+	return p.docker || p.format == "journal"
+}
+
+// linePayload returns what the application wrote in one raw line: the log of
+// a Docker json-file line, the MESSAGE of a journal entry, or the line itself
+func (p *Parser) linePayload(line string) string {
+	switch {
+	case p.docker:
+		if d, ok := parseDockerLine(line); ok {
+			return strings.TrimRight(d.Log, "\r\n")
+		}
+	case p.format == "journal":
+		if msg, ok := journalMessage(line); ok {
+			return msg
+		}
+	}
+	return line
+}
+
+// Payload returns an event as the application wrote it, without the wrapper
+// around its lines. Queries match this text, so wrapper keys such as
+// "stream" or journal fields such as _SYSTEMD_UNIT do not match every line.
+func (p *Parser) Payload(text string) string {
+	if !p.wrapped() {
+		return text
+	}
+	lines := strings.Split(text, "\n")
+	for i, l := range lines {
+		lines[i] = p.linePayload(l)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// parseEvent parses an event as written by the application
+func (p *Parser) parseEvent(appName, path, content string) (LogResult, bool) {
+	first, rest := content, ""
+	if i := strings.IndexByte(content, '\n'); i >= 0 {
+		first, rest = content[:i], content[i:]
+	}
+
+	if p.custom != nil {
+		if entry, ok := p.custom.parse(first); ok {
+			return p.structuredResult(appName, path, first, rest, entry)
+		}
+	}
+
+	if p.format == "journal" {
+		if entry, ok := parseJournalEntry(first); ok {
+			return p.structuredResult(appName, path, first, rest, entry)
+		}
+	} else if p.format != "plain" {
+		if entry, ok := parseStructured(first, p.format); ok {
+			return p.structuredResult(appName, path, first, rest, entry)
+		}
+	}
+
+	lvl := parseLevel(first)
+
+	ts, cleanedContent := parseTimestamp(first)
+	hasTimestamp := !ts.IsZero()
+	if !hasTimestamp {
+		ts = time.Now().AddDate(-1, 0, 0) // Use old date for sorting
+		cleanedContent = first
+	}
+	cleanedContent += rest
+
+	return LogResult{
+		App:       appName,
+		File:      path,
+		Level:     lvl,
+		Message:   cleanedContent,
+		Timestamp: ts,
+	}, hasTimestamp
+}
+
+// parse matches a line against the custom pattern. A timestamp group that
+// cannot be parsed is kept as a field so the value is not lost.
+func (c *customParser) parse(line string) (structuredEntry, bool) {
+	m := c.re.FindStringSubmatch(line)
+	if m == nil {
+		return structuredEntry{}, false
+	}
+
+	entry := structuredEntry{fields: make(map[string]string)}
+	for i, name := range c.fields {
+		if i == 0 || name == "" {
+			continue
+		}
+		if _, seen := entry.fields[name]; seen && m[i] == "" {
+			continue // Keep the first non-empty capture for repeated names
+		}
+		entry.fields[name] = m[i]
+	}
+
+	if _, v := takeKey(entry.fields, []string{"level"}); v != "" {
+		entry.level = normalizeLevel(v)
+	}
+	if key, v := takeKey(entry.fields, []string{"timestamp"}); v != "" {
+		if ts, ok := c.parseTime(v); ok {
+			entry.timestamp = ts
+		} else {
+			entry.fields[key] = v
+		}
+	}
+	if _, v := takeKey(entry.fields, []string{"message"}); v != "" {
+		entry.message = v
+	}
+	return entry, true
+}
+
+// parseTime parses a captured timestamp with the configured layout, or with
+// the structured-log heuristics when no layout is set
+func (c *customParser) parseTime(v string) (time.Time, bool) {
+	if c.layout == "" {
+		return parseStructuredTime(v)
+	}
+	t, err := time.ParseInLocation(c.layout, v, c.location)
+	if err != nil {
+		return time.Time{}, false
+	}
+	// Layouts without a year (e.g. syslog's "Jan _2 15:04:05") parse as year 0
+	if t.Year() == 0 {
+		now := time.Now().In(c.location)
+		t = t.AddDate(now.Year(), 0, 0)
+		if t.After(now.Add(24 * time.Hour)) {
+			t = t.AddDate(-1, 0, 0)
+		}
+	}
+	return t, true
+}
+
+// structuredResult builds a LogResult from a parsed JSON, logfmt or custom
+// pattern line, falling back to the plain-text heuristics for missing level
+// or timestamp
+func (p *Parser) structuredResult(appName, path, first, rest string, entry structuredEntry) (LogResult, bool) {
+	message := entry.message
+	if message == "" {
+		message = first
+	}
+
+	lvl := entry.level
+	if lvl == "" {
+		lvl = parseLevel(message)
+	}
+
+	ts := entry.timestamp
+	hasTimestamp := !ts.IsZero()
+	if !hasTimestamp {
+		ts = time.Now().AddDate(-1, 0, 0) // Use old date for sorting
+	}
+
+	result := LogResult{
+		App:       appName,
+		File:      path,
+		Level:     lvl,
+		Message:   message + rest,
+		Timestamp: ts,
+	}
+	if len(entry.fields) > 0 {
+		result.Fields = entry.fields
+	}
+	return result, hasTimestamp
+}
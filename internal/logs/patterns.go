@@ -0,0 +1,311 @@
+package logs
+
+import (
+	"context"
+	"log"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	patternTimeout     = 30 * time.Second // Clustering reads every matching file in full
+	maxPatterns        = 500              // Templates returned per request
+	maxPatternClusters = 10000            // Templates tracked before new shapes are only counted
+	maxPatternTokens   = 64               // Tokens of a message used for clustering
+	drainDepth         = 2                // Leading tokens used to route a message in the tree
+	drainMaxChildren   = 100              // Children per tree node before routing to the wildcard
+	drainSimilarity    = 0.4              // Share of equal tokens needed to join a template
+	patternWildcard    = "<*>"
+)
+
+// Variable parts replaced before clustering, most specific first. A match is
+// only masked if valid is nil or accepts it.
+var patternMasks = []struct {
+	re    *regexp.Regexp
+	mask  string
+	valid func(string) bool
+}{
+	{regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`), "<UUID>", nil},
+	// IPv6 candidates are whole tokens of word characters, dots and colons,
+	// so std::vector or Foo::bar are never cut into an address
+	{regexp.MustCompile(`[\w.]*:[\w.:]*\w`), "<IP>", isIPv6},
+	{regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`), "<IP>", isIP},
+	{regexp.MustCompile(`(?i)\b0x[0-9a-f]+\b`), "<HEX>", nil},
+	{regexp.MustCompile(`(?i)\b[0-9a-f]{8,}\b`), "<HEX>", isHexID},
+	{regexp.MustCompile(`(?i)[-+]?\b\d+(?:\.\d+)?(ns|us|µs|ms|s|m|h|d|b|kb|mb|gb)?\b`), "<NUM>${1}", nil},
+}
+
+// Pattern is a message template and the matches that fit it
+type Pattern struct {
+	Template  string         `json:"template"`
+	Count     int            `json:"count"`
+	FirstSeen time.Time      `json:"first_seen"` // Zero when no match had a timestamp
+	LastSeen  time.Time      `json:"last_seen"`
+	Levels    map[string]int `json:"levels"`
+	Sample    LogResult      `json:"sample"` // Newest match
+}
+
+// Patterns groups the matches of a search into message templates
+type Patterns struct {
+	Patterns     []Pattern `json:"patterns"`
+	Clusters     int       `json:"clusters"`    // Templates found, before the limit
+	Total        int       `json:"total"`       // Matches clustered
+	Unclustered  int       `json:"unclustered"` // Matches counted after the template cap was reached
+	FilesScanned int       `json:"files_scanned"`
+	FilesTotal   int       `json:"files_total"`
+	TimedOut     bool      `json:"timed_out"`
+}
+
+// SearchPatterns clusters the messages matching opts into templates, Drain
+// style, and returns the limit most frequent. Numbers, UUIDs, IPs and hex
+// values are masked first; other tokens that differ between messages of the
+// same shape become <*>. Only the first line of multi-line events is used.
+func SearchPatterns(ctx context.Context, opts SearchOptions, limit int) (Patterns, error) {
+	result := Patterns{Patterns: []Pattern{}}
+	if limit <= 0 || limit > maxPatterns {
+		limit = maxPatterns
+	}
+
+	query, err := CompileQuery(opts)
+	if err != nil {
+		return result, err
+	}
+
+	targets, err := resolveTargets(opts)
+	if err != nil {
+		return result, err
+	}
+	result.FilesTotal = len(targets)
+
+	budget, cancel := context.WithTimeout(ctx, patternTimeout)
+	defer cancel()
+
+	miner := newDrain()
+	for _, target := range targets {
+		err := walkFile(budget, target, query, opts, 0, func(hit searchHit, hasTimestamp bool) {
+			result.Total++
+			if !miner.add(hit.result, hasTimestamp) {
+				result.Unclustered++
+			}
+		})
+		if err != nil && budget.Err() != nil {
+			if ctx.Err() != nil {
+				return result, ctx.Err()
+			}
+			log.Printf("[LOGS] Pattern clustering timeout after %s, returning partial patterns", patternTimeout)
+			result.TimedOut = true
+			break
+		}
+		result.FilesScanned++
+		if err != nil {
+			log.Printf("[LOGS] Failed to search %s: %v", target.Path, err)
+		}
+	}
+
+	result.Clusters = len(miner.clusters)
+	result.Patterns = miner.top(limit)
+	return result, nil
+}
+
+// MaskMessage replaces numbers, UUIDs, IPs and hex values in a message.
+// Units after numbers are kept, so "120ms" becomes "<NUM>ms".
+func MaskMessage(message string) string {
+	if !strings.ContainsAny(message, "0123456789") {
+		return message
+	}
+	for _, m := range patternMasks {
+		if m.valid == nil {
+			message = m.re.ReplaceAllString(message, m.mask)
+			continue
+		}
+		message = m.re.ReplaceAllStringFunc(message, func(s string) string {
+			if m.valid(s) {
+				return m.mask
+			}
+			return s
+		})
+	}
+	return message
+}
+
+func isIP(s string) bool {
+	return net.ParseIP(s) != nil
+}
+
+// isIPv6 accepts tokens that are IPv6 addresses with at least one digit, so
+// identifiers such as dead::beef are left alone
+func isIPv6(s string) bool {
+	return strings.ContainsAny(s, "0123456789") && isIP(s)
+}
+
+// isHexID accepts hex strings that mix digits and letters, such as hashes
+// and trace IDs, so plain words and long numbers are left alone
+func isHexID(s string) bool {
+	return strings.ContainsAny(s, "0123456789") && strings.ContainsAny(strings.ToLower(s), "abcdef")
+}
+
+// drainCluster is one template of the miner
+type drainCluster struct {
+	tokens  []string
+	pattern Pattern
+	newest  time.Time
+}
+
+// drainNode is a node of the fixed-depth parse tree. The first level is keyed
+// by token count, the next drainDepth levels by leading tokens, and leaves
+// hold the clusters to compare against.
+type drainNode struct {
+	children map[string]*drainNode
+	clusters []*drainCluster
+}
+
+// drain is a streaming template miner after "Drain: An Online Log Parsing
+// Approach with Fixed Depth Tree" (He et al., 2017)
+type drain struct {
+	root     drainNode
+	clusters []*drainCluster
+}
+
+func newDrain() *drain {
+	return &drain{root: drainNode{children: make(map[string]*drainNode)}}
+}
+
+// add assigns a match to the most similar template, creating one if none is
+// close enough. It returns false when the template cap stops a new one.
+func (d *drain) add(r LogResult, hasTimestamp bool) bool {
+	message := r.Message
+	if i := strings.IndexByte(message, '\n'); i >= 0 {
+		message = message[:i]
+	}
+	tokens := strings.Fields(MaskMessage(message))
+	if len(tokens) > maxPatternTokens {
+		tokens = tokens[:maxPatternTokens]
+	}
+
+	leaf := d.leaf(tokens)
+	cluster := leaf.match(tokens)
+	if cluster == nil {
+		if len(d.clusters) >= maxPatternClusters {
+			return false
+		}
+		cluster = &drainCluster{
+			tokens:  append([]string(nil), tokens...),
+			pattern: Pattern{Levels: make(map[string]int), Sample: r},
+		}
+		leaf.clusters = append(leaf.clusters, cluster)
+		d.clusters = append(d.clusters, cluster)
+	} else {
+		for i, t := range tokens {
+			if cluster.tokens[i] != t {
+				cluster.tokens[i] = patternWildcard
+			}
+		}
+	}
+
+	p := &cluster.pattern
+	p.Count++
+	p.Levels[r.Level]++
+	if hasTimestamp {
+		if p.FirstSeen.IsZero() || r.Timestamp.Before(p.FirstSeen) {
+			p.FirstSeen = r.Timestamp
+		}
+		if r.Timestamp.After(p.LastSeen) {
+			p.LastSeen = r.Timestamp
+		}
+		if !r.Timestamp.Before(cluster.newest) {
+			cluster.newest = r.Timestamp
+			p.Sample = r
+		}
+	}
+	return true
+}
+
+// leaf walks, and grows, the tree down to the leaf for a token list
+func (d *drain) leaf(tokens []string) *drainNode {
+	keys := []string{strconv.Itoa(len(tokens))}
+	for i := 0; i < drainDepth && i < len(tokens); i++ {
+		keys = append(keys, tokens[i])
+	}
+
+	node := &d.root
+	for depth, key := range keys {
+		if depth > 0 && hasVariable(key) {
+			key = patternWildcard
+		}
+		child, ok := node.children[key]
+		if !ok {
+			if depth > 0 && len(node.children) >= drainMaxChildren {
+				key = patternWildcard
+				child, ok = node.children[key]
+			}
+			if !ok {
+				child = &drainNode{children: make(map[string]*drainNode)}
+				node.children[key] = child
+			}
+		}
+		node = child
+	}
+	return node
+}
+
+// match returns the most similar cluster of a leaf, or nil if none reaches
+// drainSimilarity. Ties go to the template with fewer wildcards.
+func (n *drainNode) match(tokens []string) *drainCluster {
+	var best *drainCluster
+	bestSim, bestWild := -1.0, 0
+	for _, c := range n.clusters {
+		same, wild := 0, 0
+		for i, t := range c.tokens {
+			switch {
+			case t == patternWildcard:
+				wild++
+			case t == tokens[i]:
+				same++
+			}
+		}
+		sim := 1.0
+		if len(tokens) > 0 {
+			sim = float64(same) / float64(len(tokens))
+		}
+		if sim > bestSim || (sim == bestSim && wild < bestWild) {
+			best, bestSim, bestWild = c, sim, wild
+		}
+	}
+	if best == nil || bestSim < drainSimilarity {
+		return nil
+	}
+	return best
+}
+
+// top returns the n most frequent templates
+func (d *drain) top(n int) []Pattern {
+	list := make([]Pattern, 0, len(d.clusters))
+	for _, c := range d.clusters {
+		p := c.pattern
+		p.Template = strings.Join(c.tokens, " ")
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Count != list[j].Count {
+			return list[i].Count > list[j].Count
+		}
+		return list[i].Template < list[j].Template
+	})
+	if len(list) > n {
+		list = list[:n]
+	}
+	return list
+}
+
+// hasVariable reports whether a token is a mask or still contains digits,
+// which makes it a poor key for routing in the tree
+func hasVariable(token string) bool {
+	if strings.HasPrefix(token, "<") && strings.HasSuffix(token, ">") {
+		return true
+	}
+	return strings.ContainsAny(token, "0123456789")
+}
@@ -0,0 +1,38 @@
+package logs
+
+import "testing"
+
+func TestMaskMessage(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"server started", "server started"},
+		{"retry 3 of 5", "retry <NUM> of <NUM>"},
+		{"took 250ms, read 12kb", "took <NUM>ms, read <NUM>kb"},
+		{"offset -42", "offset <NUM>"},
+		{"request 3f2b8c1e-9d4a-4e6b-8f1a-2c3d4e5f6a7b done", "request <UUID> done"},
+		{"from 10.0.0.1 port 22", "from <IP> port <NUM>"},
+		{"connect 10.0.0.1:8080", "connect <IP>:<NUM>"},
+		{"not an ip 999.1.1.1", "not an ip <NUM>.<NUM>"},
+		{"from fe80::1 port 22", "from <IP> port <NUM>"},
+		{"listening on [::1]:8080", "listening on [<IP>]:<NUM>"},
+		{"client 2001:db8::ff00:42:8329.", "client <IP>."},
+		{"peer ::ffff:192.168.1.1 closed", "peer <IP> closed"},
+		{"ptr 0x7ffd5a3c", "ptr <HEX>"},
+		{"commit 9fceb02d0ae598e95dc970b74767f19372d61af8", "commit <HEX>"},
+		{"deadbeef and 12345678", "deadbeef and <NUM>"},
+		// Scope operators are not IPv6 addresses
+		{"std::vector failed 3 times", "std::vector failed <NUM> times"},
+		{"Foo::bar called 2x", "Foo::bar called 2x"},
+		{"Logger::debug at 1", "Logger::debug at <NUM>"},
+		{"tokio::net::tcp error 5", "tokio::net::tcp error <NUM>"},
+		{"App\\Http\\Kernel::handle 500", "App\\Http\\Kernel::handle <NUM>"},
+		{"dead::beef 1", "dead::beef <NUM>"},
+		{"at 10:00:00", "at <NUM>:<NUM>:<NUM>"},
+	}
+	for _, tt := range tests {
+		if got := MaskMessage(tt.in); got != tt.want {
+			t.Errorf("MaskMessage(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
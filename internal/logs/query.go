@@ -0,0 +1,433 @@
+package logs
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Query is a compiled search expression. The language supports:
+//
+//	timeout                 bare word, case-insensitive substring of the line
+//	"connection refused"    quoted phrase, case-insensitive substring
+//	/time(d)?out/           regex literal, case-insensitive; a standalone /.../
+//	                        only, so /var/log or path:/api/users are plain words
+//	level:ERROR             field filter, case-insensitive equality (* is a wildcard)
+//	app:"App One"           field filter with a quoted value
+//	file:/error\.log$/      field filter with a regex value
+//	a AND b, a OR b, NOT a  boolean operators (adjacent terms are ANDed)
+//	(a OR b) AND NOT c      grouping
+//
+// Fields are the LogResult fields: level, app, file and message (or msg).
+// Any other name filters on the structured fields of JSON and logfmt lines
+// (user.id:42); lines without that field never match.
+type Query struct {
+	root queryNode
+}
+
+// queryFields maps the names accepted in field filters to LogResult fields
+var queryFields = map[string]func(r *LogResult) string{
+	"level":   func(r *LogResult) string { return r.Level },
+	"app":     func(r *LogResult) string { return r.App },
+	"file":    func(r *LogResult) string { return r.File },
+	"message": func(r *LogResult) string { return r.Message },
+	"msg":     func(r *LogResult) string { return r.Message },
+}
+
+// Names of structured fields usable in field filters
+var fieldNameRegex = regexp.MustCompile(`^[A-Za-z_@][\w.@-]*$`)
+
+// fieldGetter returns the accessor for a field filter name
+func fieldGetter(name string) func(r *LogResult) (string, bool) {
+	if get, ok := queryFields[strings.ToLower(name)]; ok {
+		return func(r *LogResult) (string, bool) { return get(r), true }
+	}
+	return func(r *LogResult) (string, bool) {
+		v, ok := r.Fields[name]
+		return v, ok
+	}
+}
+
+// queryLine is the line being evaluated. The parsed LogResult and the
+// lower-cased text are computed on first use only.
+type queryLine struct {
+	raw    string
+	lower  string
+	parse  func() LogResult
+	result *LogResult
+}
+
+func (l *queryLine) lowered() string {
+	if l.lower == "" && l.raw != "" {
+		l.lower = strings.ToLower(l.raw)
+	}
+	return l.lower
+}
+
+func (l *queryLine) parsed() *LogResult {
+	if l.result == nil {
+		r := l.parse()
+		l.result = &r
+	}
+	return l.result
+}
+
+type queryNode interface {
+	match(l *queryLine) bool
+}
+
+type andNode struct{ left, right queryNode }
+type orNode struct{ left, right queryNode }
+type notNode struct{ child queryNode }
+type textNode struct{ needle string } // Lower-cased
+type regexNode struct{ re *regexp.Regexp }
+type fieldNode struct {
+	name  string
+	get   func(r *LogResult) (string, bool)
+	value valueMatcher
+}
+
+func (n andNode) match(l *queryLine) bool   { return n.left.match(l) && n.right.match(l) }
+func (n orNode) match(l *queryLine) bool    { return n.left.match(l) || n.right.match(l) }
+func (n notNode) match(l *queryLine) bool   { return !n.child.match(l) }
+func (n textNode) match(l *queryLine) bool  { return strings.Contains(l.lowered(), n.needle) }
+func (n regexNode) match(l *queryLine) bool { return n.re.MatchString(l.raw) }
+func (n fieldNode) match(l *queryLine) bool {
+	v, ok := n.get(l.parsed())
+	return ok && n.value(v)
+}
+
+// valueMatcher tests a single field value
+type valueMatcher func(value string) bool
+
+// Match reports whether a raw line matches the query. parse is only called
+// when a field filter needs the parsed LogResult. An empty query matches any
+// non-empty line.
+func (q *Query) Match(line string, parse func() LogResult) bool {
+	if q == nil || q.root == nil {
+		return line != ""
+	}
+	return q.root.match(&queryLine{raw: line, parse: parse})
+}
+
+// And combines two queries so that both must match
+func (q *Query) And(other *Query) *Query {
+	switch {
+	case other == nil || other.root == nil:
+		return q
+	case q == nil || q.root == nil:
+		return other
+	}
+	return &Query{root: andNode{left: q.root, right: other.root}}
+}
+
+// RegexQuery compiles a plain case-insensitive regular expression (the
+// pre-query-language search mode) into a Query.
+func RegexQuery(pattern string) (*Query, error) {
+	if pattern == "" {
+		return &Query{}, nil
+	}
+	re, err := regexp.Compile("(?i)" + pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid search pattern: %w", err)
+	}
+	return &Query{root: regexNode{re: re}}, nil
+}
+
+// ParseQuery compiles an expression in the search query language
+func ParseQuery(input string) (*Query, error) {
+	tokens, err := lexQuery(input)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return &Query{}, nil
+	}
+
+	p := &queryParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.done() {
+		return nil, fmt.Errorf("unexpected %s at position %d", p.peek().describe(), p.peek().pos)
+	}
+	return &Query{root: root}, nil
+}
+
+// Lexer
+
+type tokenKind int
+
+const (
+	tokWord tokenKind = iota
+	tokPhrase
+	tokRegex
+	tokField // Field name; the following token is its value
+	tokAnd
+	tokOr
+	tokNot
+	tokLParen
+	tokRParen
+)
+
+type queryToken struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t queryToken) describe() string {
+	switch t.kind {
+	case tokLParen:
+		return "'('"
+	case tokRParen:
+		return "')'"
+	case tokAnd, tokOr, tokNot:
+		return t.text
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+func isQueryDelimiter(r rune) bool {
+	return unicode.IsSpace(r) || r == '(' || r == ')' || r == '"'
+}
+
+func lexQuery(input string) ([]queryToken, error) {
+	var tokens []queryToken
+	runes := []rune(input)
+	i := 0
+
+	for i < len(runes) {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, queryToken{kind: tokLParen, text: "(", pos: i})
+			i++
+		case r == ')':
+			tokens = append(tokens, queryToken{kind: tokRParen, text: ")", pos: i})
+			i++
+		case r == '"':
+			text, next, err := lexDelimited(runes, i, '"')
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, queryToken{kind: tokPhrase, text: text, pos: i})
+			i = next
+		case r == '/' && isRegexLiteral(runes, i):
+			text, next, err := lexDelimited(runes, i, '/')
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, queryToken{kind: tokRegex, text: text, pos: i})
+			i = next
+		default:
+			start := i
+			for i < len(runes) && !isQueryDelimiter(runes[i]) && runes[i] != ':' {
+				i++
+			}
+			word := string(runes[start:i])
+
+			// field:value
+			if i < len(runes) && runes[i] == ':' {
+				if isFieldFilter(word, runes[i+1:]) {
+					tokens = append(tokens, queryToken{kind: tokField, text: word, pos: start})
+					i++
+					continue
+				}
+				// Not a field (e.g. 10:00:01 or a URL), keep reading the word
+				for i < len(runes) && !isQueryDelimiter(runes[i]) {
+					i++
+				}
+				word = string(runes[start:i])
+			}
+
+			switch word {
+			case "AND", "&&":
+				tokens = append(tokens, queryToken{kind: tokAnd, text: "AND", pos: start})
+			case "OR", "||":
+				tokens = append(tokens, queryToken{kind: tokOr, text: "OR", pos: start})
+			case "NOT", "!":
+				tokens = append(tokens, queryToken{kind: tokNot, text: "NOT", pos: start})
+			default:
+				tokens = append(tokens, queryToken{kind: tokWord, text: word, pos: start})
+			}
+		}
+	}
+	return tokens, nil
+}
+
+// isFieldFilter reports whether word followed by ':' and rest starts a field
+// filter rather than being part of a plain word such as a URL or a time
+func isFieldFilter(word string, rest []rune) bool {
+	if len(rest) == 0 || unicode.IsSpace(rest[0]) {
+		return false
+	}
+	if _, ok := queryFields[strings.ToLower(word)]; ok {
+		return true
+	}
+	return fieldNameRegex.MatchString(word) && !strings.HasPrefix(string(rest), "//")
+}
+
+// isRegexLiteral reports whether the '/' at runes[start] opens a standalone
+// regex literal: one closed by a later '/' that ends the token. Anything else
+// starting with '/', such as a path, is lexed as a word.
+func isRegexLiteral(runes []rune, start int) bool {
+	_, next, err := lexDelimited(runes, start, '/')
+	return err == nil && (next == len(runes) || isQueryDelimiter(runes[next]))
+}
+
+// lexDelimited reads a quoted phrase or regex literal starting at runes[start].
+// A backslash escapes the delimiter; in phrases it also escapes itself.
+func lexDelimited(runes []rune, start int, delim rune) (string, int, error) {
+	var sb strings.Builder
+	for i := start + 1; i < len(runes); i++ {
+		r := runes[i]
+		if r == '\\' && i+1 < len(runes) && (runes[i+1] == delim || (delim == '"' && runes[i+1] == '\\')) {
+			sb.WriteRune(runes[i+1])
+			i++
+			continue
+		}
+		if r == delim {
+			return sb.String(), i + 1, nil
+		}
+		sb.WriteRune(r)
+	}
+	if delim == '"' {
+		return "", 0, fmt.Errorf("unterminated phrase starting at position %d", start)
+	}
+	return "", 0, fmt.Errorf("unterminated regex starting at position %d", start)
+}
+
+// Parser (precedence: NOT > AND > OR)
+
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+}
+
+func (p *queryParser) done() bool { return p.pos >= len(p.tokens) }
+
+func (p *queryParser) peek() queryToken { return p.tokens[p.pos] }
+
+func (p *queryParser) next() queryToken {
+	t := p.tokens[p.pos]
+	p.pos++
+	return t
+}
+
+func (p *queryParser) parseOr() (queryNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for !p.done() && p.peek().kind == tokOr {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseAnd() (queryNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for !p.done() {
+		switch p.peek().kind {
+		case tokAnd:
+			p.next()
+		case tokOr, tokRParen:
+			return left, nil
+		}
+		// Adjacent terms are implicitly ANDed
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseNot() (queryNode, error) {
+	if !p.done() && p.peek().kind == tokNot {
+		p.next()
+		child, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{child: child}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *queryParser) parsePrimary() (queryNode, error) {
+	if p.done() {
+		return nil, fmt.Errorf("unexpected end of query")
+	}
+
+	t := p.next()
+	switch t.kind {
+	case tokLParen:
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.done() || p.peek().kind != tokRParen {
+			return nil, fmt.Errorf("missing ')' for '(' at position %d", t.pos)
+		}
+		p.next()
+		return node, nil
+	case tokWord, tokPhrase:
+		return textNode{needle: strings.ToLower(t.text)}, nil
+	case tokRegex:
+		re, err := regexp.Compile("(?i)" + t.text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex at position %d: %w", t.pos, err)
+		}
+		return regexNode{re: re}, nil
+	case tokField:
+		if p.done() {
+			return nil, fmt.Errorf("missing value for field %q", t.text)
+		}
+		matcher, err := compileValue(p.next())
+		if err != nil {
+			return nil, err
+		}
+		return fieldNode{name: t.text, get: fieldGetter(t.text), value: matcher}, nil
+	}
+	return nil, fmt.Errorf("unexpected %s at position %d", t.describe(), t.pos)
+}
+
+// compileValue builds the matcher for the value of a field filter
+func compileValue(t queryToken) (valueMatcher, error) {
+	switch t.kind {
+	case tokRegex:
+		re, err := regexp.Compile("(?i)" + t.text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex at position %d: %w", t.pos, err)
+		}
+		return re.MatchString, nil
+	case tokPhrase:
+		return func(v string) bool { return strings.EqualFold(v, t.text) }, nil
+	case tokWord:
+		if !strings.Contains(t.text, "*") {
+			return func(v string) bool { return strings.EqualFold(v, t.text) }, nil
+		}
+		parts := strings.Split(t.text, "*")
+		for i, part := range parts {
+			parts[i] = regexp.QuoteMeta(part)
+		}
+		re := regexp.MustCompile("(?is)^" + strings.Join(parts, ".*") + "$")
+		return re.MatchString, nil
+	}
+	return nil, fmt.Errorf("unexpected %s at position %d, expected a field value", t.describe(), t.pos)
+}
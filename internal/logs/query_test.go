@@ -0,0 +1,151 @@
+package logs
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestQueryMatch(t *testing.T) {
+	line := `10:00:00 ERROR Connection refused: dial tcp db:5432, see https://status.io/db`
+	result := LogResult{
+		App: "App One", File: "/var/log/app/error.log", Level: "ERROR",
+		Message: "Connection refused", Fields: map[string]string{"user.id": "42", "host": "web-1"},
+	}
+
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"", true},
+		{"refused", true},
+		{"REFUSED", true},
+		{"timeout", false},
+		{`"connection refused"`, true},
+		{`"refused connection"`, false},
+		{`/time(d)?out|refus/`, true},
+		{"connection refused", true},
+		{"connection timeout", false},
+		{"connection AND timeout", false},
+		{"connection OR timeout", true},
+		{"NOT timeout", true},
+		{"NOT refused", false},
+		{"timeout OR NOT refused", false},
+		{"(timeout OR refused) AND NOT warning", true},
+		{"refused AND (timeout OR warning)", false},
+		{"timeout OR refused AND dial", true},
+		{"level:error", true},
+		{"level:WARN", false},
+		{"level:err*", true},
+		{`app:"app one"`, true},
+		{"app:App", false},
+		{`file:/error\.log$/`, true},
+		{"message:*refused", true},
+		{"msg:refused", false},
+		{"user.id:42", true},
+		{"user.id:43", false},
+		{"missing:*", false},
+		{"NOT missing:*", true},
+		{"level:ERROR host:web-*", true},
+		// Not field filters: a time and a URL are plain words
+		{"10:00:00", true},
+		{"https://status.io/db", true},
+		// Only a standalone /.../ is a regex; paths are plain words
+		{"/db", true},
+		{"/status.io/db", true},
+		{"/status.io/dbx", false},
+		{"file:/var/log/app/error.log", true},
+		{"file:/var/log/*", true},
+		{"file:/var/log", false},
+		{"file:/var/log/app/", false},
+		{`file:/\/app\//`, true},
+		{"(/refus/)", true},
+		{"/refus/ AND /db", true},
+		{"/refused/x", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := q.Match(line, func() LogResult { return result }); got != tt.want {
+				t.Errorf("Match = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryParsesOnlyForFields(t *testing.T) {
+	parsed := 0
+	parse := func() LogResult {
+		parsed++
+		return LogResult{Level: "INFO"}
+	}
+	for _, query := range []string{"started", `"server started"`, "/start/", "started OR stopped"} {
+		q, err := ParseQuery(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		q.Match("server started", parse)
+	}
+	if parsed != 0 {
+		t.Errorf("text terms parsed the line %d times", parsed)
+	}
+
+	q, err := ParseQuery("level:info level:* started")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !q.Match("server started", parse) || parsed != 1 {
+		t.Errorf("parsed %d times, want once", parsed)
+	}
+}
+
+func TestQueryErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		err   string
+	}{
+		{`"unterminated`, "unterminated phrase"},
+		{"/(/", "invalid regex"},
+		{"level:/(/", "invalid regex"},
+		{"(a OR b", "missing ')'"},
+		{"a OR b)", "unexpected"},
+		{"a AND", "unexpected end of query"},
+		{"NOT", "unexpected end of query"},
+		{"level:(", "expected a field value"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			_, err := ParseQuery(tt.query)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestRegexQuery(t *testing.T) {
+	tests := []struct {
+		pattern, line string
+		want          bool
+	}{
+		{"", "anything", true},
+		{"", "", false},
+		{"err(or)?", "An ERROR occurred", true},
+		{"^warn", "an error", false},
+		{"level:error", "level:error is plain text here", true},
+	}
+	for _, tt := range tests {
+		q, err := RegexQuery(tt.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := q.Match(tt.line, nil); got != tt.want {
+			t.Errorf("RegexQuery(%q).Match(%q) = %v, want %v", tt.pattern, tt.line, got, tt.want)
+		}
+	}
+	if _, err := RegexQuery("(unclosed"); err == nil {
+		t.Error("invalid pattern compiled")
+	}
+}
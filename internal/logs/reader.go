@@ -0,0 +1,97 @@
+package logs
+
+import (
+	"archive/zip"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pierrec/lz4/v4"
+	"github.com/ulikunitz/xz"
+)
+
+// logReader wraps a (possibly decompressing) reader and closes every
+// underlying resource when done
+type logReader struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (r *logReader) Close() error {
+	var firstErr error
+	// Close in reverse order: decompressors first, then the file
+	for i := len(r.closers) - 1; i >= 0; i-- {
+		if err := r.closers[i].Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// openLogReader opens a log file and transparently decompresses
+// .gz, .bz2, .xz, .lz4 and .zip archives based on the file extension
+func openLogReader(path string) (io.ReadCloser, error) {
+	lower := strings.ToLower(path)
+
+	if strings.HasSuffix(lower, ".zip") {
+		return openZipReader(path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case strings.HasSuffix(lower, ".gz"):
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return &logReader{Reader: gz, closers: []io.Closer{f, gz}}, nil
+	case strings.HasSuffix(lower, ".bz2"):
+		return &logReader{Reader: bzip2.NewReader(f), closers: []io.Closer{f}}, nil
+	case strings.HasSuffix(lower, ".xz"):
+		xr, err := xz.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return &logReader{Reader: xr, closers: []io.Closer{f}}, nil
+	case strings.HasSuffix(lower, ".lz4"):
+		return &logReader{Reader: lz4.NewReader(f), closers: []io.Closer{f}}, nil
+	}
+
+	return f, nil
+}
+
+// openZipReader concatenates every file entry of a zip archive into one stream
+func openZipReader(path string) (io.ReadCloser, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var readers []io.Reader
+	closers := []io.Closer{zr}
+	for _, entry := range zr.File {
+		if entry.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := entry.Open()
+		if err != nil {
+			for _, c := range closers {
+				c.Close()
+			}
+			return nil, err
+		}
+		closers = append(closers, rc)
+		// Separate entries so the last line of one never merges with the next
+		readers = append(readers, rc, strings.NewReader("\n"))
+	}
+
+	return &logReader{Reader: io.MultiReader(readers...), closers: closers}, nil
+}
@@ -0,0 +1,158 @@
+package logs
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pierrec/lz4/v4"
+	"github.com/ulikunitz/xz"
+)
+
+const readerLines = "2024-01-15T10:00:00Z INFO first\n2024-01-15T10:00:01Z ERROR second\n"
+
+// bzip2Lines is readerLines compressed with the bzip2 tool, as the standard
+// library can only decompress bzip2
+var bzip2Lines = []byte{
+	0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59, 0x4e, 0x64,
+	0x81, 0xcd, 0x00, 0x00, 0x0f, 0x5f, 0x80, 0x00, 0x10, 0x40, 0x02, 0x76,
+	0x10, 0x03, 0x21, 0x94, 0x10, 0x0f, 0x21, 0x9c, 0x00, 0x20, 0x00, 0x54,
+	0x50, 0x00, 0x00, 0x0d, 0x32, 0x09, 0x53, 0x48, 0xd0, 0x69, 0xe5, 0x07,
+	0xea, 0x80, 0x0b, 0xe4, 0x6b, 0xb6, 0x45, 0x48, 0x95, 0x46, 0x72, 0xc1,
+	0xe4, 0x22, 0x84, 0xdc, 0x62, 0x85, 0x09, 0x84, 0x26, 0x49, 0xe1, 0x92,
+	0x31, 0x86, 0xc0, 0xa4, 0x03, 0xe1, 0x59, 0x37, 0xe2, 0xee, 0x48, 0xa7,
+	0x0a, 0x12, 0x09, 0xcc, 0x90, 0x39, 0xa0,
+}
+
+// compress writes data with a compressing writer from the same library the
+// reader uses
+func compress(t *testing.T, data string, newWriter func(io.Writer) (io.WriteCloser, error)) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := newWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(w, data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// zipArchive builds a zip with the given members, in order; names ending in
+// "/" are directories
+func zipArchive(t *testing.T, members ...[2]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, m := range members {
+		w, err := zw.Create(m[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, m[1])
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestOpenLogReader(t *testing.T) {
+	gzipWriter := func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil }
+	xzWriter := func(w io.Writer) (io.WriteCloser, error) { return xz.NewWriter(w) }
+	lz4Writer := func(w io.Writer) (io.WriteCloser, error) { return lz4.NewWriter(w), nil }
+
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"app.log", []byte(readerLines), readerLines},
+		{"app.log.1.gz", compress(t, readerLines, gzipWriter), readerLines},
+		{"APP.LOG.GZ", compress(t, readerLines, gzipWriter), readerLines},
+		{"app.log.bz2", bzip2Lines, readerLines},
+		{"app.log.xz", compress(t, readerLines, xzWriter), readerLines},
+		{"app.log.lz4", compress(t, readerLines, lz4Writer), readerLines},
+		{"app.zip", zipArchive(t, [2]string{"app.log", readerLines}), readerLines + "\n"},
+		// Members are read in order, each ending a line, and directories skipped
+		{"logs.zip", zipArchive(t,
+			[2]string{"old/", ""},
+			[2]string{"old/app.log.1", "2024-01-14T23:59:59Z INFO last of day"},
+			[2]string{"app.log", readerLines},
+		), "2024-01-14T23:59:59Z INFO last of day\n" + readerLines + "\n"},
+		{"empty.zip", zipArchive(t), ""},
+	}
+	dir := t.TempDir()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name)
+			if err := os.WriteFile(path, tt.data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			r, err := openLogReader(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := r.Close(); err != nil {
+				t.Errorf("close: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpenLogReaderCorrupt(t *testing.T) {
+	gz := compress(t, readerLines, func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil })
+	zipped := zipArchive(t, [2]string{"app.log", readerLines})
+	// A member whose data no longer matches its checksum; it starts after the
+	// 30-byte local header and the name
+	damaged := append([]byte(nil), zipped...)
+	damaged[30+len("app.log")+2] ^= 0xff
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"not-gzip.gz", []byte(readerLines)},
+		{"truncated.gz", gz[:len(gz)/2]},
+		{"not-bzip2.bz2", []byte(readerLines)},
+		{"truncated.bz2", bzip2Lines[:len(bzip2Lines)/2]},
+		{"not-xz.xz", []byte(readerLines)},
+		{"not-lz4.lz4", []byte(readerLines)},
+		{"not-zip.zip", []byte(readerLines)},
+		{"truncated.zip", zipped[:len(zipped)-10]},
+		{"damaged-member.zip", damaged},
+	}
+	dir := t.TempDir()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name)
+			if err := os.WriteFile(path, tt.data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			// Either opening or reading fails, never a silent short read
+			r, err := openLogReader(path)
+			if err == nil {
+				_, err = io.ReadAll(r)
+				r.Close()
+			}
+			if err == nil {
+				t.Error("corrupt archive read without error")
+			}
+		})
+	}
+}
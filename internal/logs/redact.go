@@ -0,0 +1,267 @@
+package logs
+
+import (
+	"fmt"
+	"logmojo/internal/config"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Built-in redaction detectors. A match is only redacted if valid is nil or
+// accepts it; with a group, only the first group is replaced.
+var redactionDetectors = map[string]struct {
+	re    *regexp.Regexp
+	valid func(string) bool
+}{
+	"email":          {regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`), nil},
+	"credit_card":    {regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`), isCardNumber},
+	"jwt":            {regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`), nil},
+	"bearer":         {regexp.MustCompile(`(?i)\bbearer\s+([A-Za-z0-9._~+/-]+=*)`), nil},
+	"aws_access_key": {regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`), nil},
+	"password":       {regexp.MustCompile(`(?i)\b(?:password|passwd|pwd|secret|api[_-]?key|access[_-]?token|token)["']?\s*[=:]\s*["']?([^\s"',;&]+)`), nil},
+}
+
+// redactionRule is a compiled config.RedactionRule
+type redactionRule struct {
+	name        string
+	detector    string
+	pattern     string
+	app         string // Empty for rules of every app
+	re          *regexp.Regexp
+	valid       func(string) bool
+	replacement string
+}
+
+// RedactionStat is a redaction rule and how often it fired since startup
+type RedactionStat struct {
+	Name     string           `json:"name"`
+	Detector string           `json:"detector,omitempty"`
+	Pattern  string           `json:"pattern,omitempty"`
+	App      string           `json:"app,omitempty"` // Empty for rules of every app
+	Hits     int64            `json:"hits"`
+	ByApp    map[string]int64 `json:"by_app"`
+	LastHit  *time.Time       `json:"last_hit,omitempty"`
+}
+
+var redaction = struct {
+	sync.Mutex
+	rules []redactionRule
+	stats []RedactionStat
+}{}
+
+// InitRedaction compiles the global redaction rules and those of each app
+func InitRedaction() error {
+	var rules []redactionRule
+	add := func(app string, cfgs []config.RedactionRule) error {
+		for _, cfg := range cfgs {
+			rule, err := compileRedaction(cfg)
+			if err != nil {
+				if app != "" {
+					return fmt.Errorf("redaction rule of %s: %w", app, err)
+				}
+				return fmt.Errorf("redaction rule: %w", err)
+			}
+			rule.app = app
+			rules = append(rules, rule)
+		}
+		return nil
+	}
+	if err := add("", config.AppConfigData.Redaction); err != nil {
+		return err
+	}
+	for _, app := range config.Apps() {
+		if err := add(app.Name, app.Redact); err != nil {
+			return err
+		}
+	}
+
+	stats := make([]RedactionStat, len(rules))
+	for i, r := range rules {
+		stats[i] = RedactionStat{Name: r.name, Detector: r.detector, Pattern: r.pattern, App: r.app, ByApp: map[string]int64{}}
+	}
+	redaction.Lock()
+	redaction.rules, redaction.stats = rules, stats
+	redaction.Unlock()
+	return nil
+}
+
+func compileRedaction(cfg config.RedactionRule) (redactionRule, error) {
+	rule := redactionRule{name: cfg.Name, detector: cfg.Detector, pattern: cfg.Pattern, replacement: cfg.Replacement}
+	switch {
+	case cfg.Detector != "" && cfg.Pattern != "":
+		return rule, fmt.Errorf("use either detector or pattern")
+	case cfg.Detector != "":
+		d, ok := redactionDetectors[cfg.Detector]
+		if !ok {
+			return rule, fmt.Errorf("unknown detector %q", cfg.Detector)
+		}
+		rule.re, rule.valid = d.re, d.valid
+		if rule.name == "" {
+			rule.name = cfg.Detector
+		}
+	case cfg.Pattern != "":
+		re, err := regexp.Compile(cfg.Pattern)
+		if err != nil {
+			return rule, fmt.Errorf("invalid pattern: %w", err)
+		}
+		rule.re = re
+		if rule.name == "" {
+			return rule, fmt.Errorf("pattern %q needs a name", cfg.Pattern)
+		}
+	default:
+		return rule, fmt.Errorf("a detector or pattern is required")
+	}
+	if rule.replacement == "" {
+		rule.replacement = "[REDACTED:" + rule.name + "]"
+	}
+	return rule, nil
+}
+
+// Redact masks the values matched by the global rules and those of app
+func Redact(app, text string) string {
+	return redactApps(text, app)
+}
+
+// RedactPayload masks text like Redact without counting hits, for content
+// that is only matched against a query and never sent as is
+func RedactPayload(app, text string) string {
+	return redactText(text, []string{app}, false)
+}
+
+// redactApps masks text with the global rules and those of every app in
+// apps, for output that mixes several apps. Hits count against apps[0].
+func redactApps(text string, apps ...string) string {
+	return redactText(text, apps, true)
+}
+
+// redactText masks text with the global rules and those of apps, counting
+// hits against apps[0] if record is set
+func redactText(text string, apps []string, record bool) string {
+	redaction.Lock()
+	rules := redaction.rules
+	redaction.Unlock()
+	if len(rules) == 0 || text == "" {
+		return text
+	}
+
+	for i := range rules {
+		r := &rules[i]
+		if r.app != "" && !containsString(apps, r.app) {
+			continue
+		}
+		var b strings.Builder
+		last, hits := 0, 0
+		for _, loc := range r.re.FindAllStringSubmatchIndex(text, -1) {
+			if r.valid != nil && !r.valid(text[loc[0]:loc[1]]) {
+				continue
+			}
+			// Replace only the first group, as in password=<value>
+			start, end := loc[0], loc[1]
+			if len(loc) > 2 && loc[2] >= 0 {
+				start, end = loc[2], loc[3]
+			}
+			b.WriteString(text[last:start])
+			b.WriteString(r.replacement)
+			last = end
+			hits++
+		}
+		if hits == 0 {
+			continue
+		}
+		b.WriteString(text[last:])
+		text = b.String()
+
+		if record {
+			app := ""
+			if len(apps) > 0 {
+				app = apps[0]
+			}
+			recordRedaction(i, app, hits)
+		}
+	}
+	return text
+}
+
+func recordRedaction(rule int, app string, hits int) {
+	now := time.Now()
+	redaction.Lock()
+	defer redaction.Unlock()
+	if rule >= len(redaction.stats) {
+		return
+	}
+	s := &redaction.stats[rule]
+	s.Hits += int64(hits)
+	s.ByApp[app] += int64(hits)
+	s.LastHit = &now
+}
+
+// RedactResult masks the message and field values of a result. Search
+// results are redacted before they are matched; live tail entries are
+// redacted by the tail before its query runs.
+func RedactResult(r *LogResult) {
+	redactResult(r, []string{r.App})
+}
+
+// redactResult masks a result with the global rules and those of apps
+func redactResult(r *LogResult, apps []string) {
+	r.Message = redactApps(r.Message, apps...)
+	for k, v := range r.Fields {
+		r.Fields[k] = redactApps(v, apps...)
+	}
+}
+
+// RedactionStats returns every rule with the number of values it masked
+// since startup, most used first
+func RedactionStats() []RedactionStat {
+	redaction.Lock()
+	stats := make([]RedactionStat, len(redaction.stats))
+	for i, s := range redaction.stats {
+		byApp := make(map[string]int64, len(s.ByApp))
+		for app, n := range s.ByApp {
+			byApp[app] = n
+		}
+		s.ByApp = byApp
+		stats[i] = s
+	}
+	redaction.Unlock()
+
+	sort.SliceStable(stats, func(i, j int) bool { return stats[i].Hits > stats[j].Hits })
+	return stats
+}
+
+// isCardNumber checks the Luhn checksum of a candidate card number
+func isCardNumber(s string) bool {
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, s)
+	// Card numbers start with 2-6, which also keeps epoch milliseconds out
+	if len(digits) < 13 || len(digits) > 19 || digits[0] < '2' || digits[0] > '6' {
+		return false
+	}
+	sum := 0
+	for i := 0; i < len(digits); i++ {
+		d := int(digits[len(digits)-1-i] - '0')
+		if i%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
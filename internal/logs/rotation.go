@@ -0,0 +1,300 @@
+package logs
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"logmojo/internal/config"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Lines read from the start of a file to find its first timestamp
+	spanProbeLines = 50
+	// Bytes compared to tell whether a file was rewritten since it was probed
+	spanHeadBytes = 256
+)
+
+var (
+	compressedExts = []string{".gz", ".bz2", ".xz", ".lz4", ".zip"}
+
+	// logrotate numbering: app.log.1, or an index before the extension: app.1.log
+	numberedSuffixRe = regexp.MustCompile(`\.(\d{1,4})$`)
+	numberedInfixRe  = regexp.MustCompile(`\.(\d{1,4})(\.[A-Za-z]+)$`)
+	// Dates in names: app.log-20240115 (dateext), app.log.2024-01-15,
+	// app-2024-01-15.log or app-2024-01-15T10-00-00.log, with optional time
+	nameDateRe = regexp.MustCompile(`[-_.]?(\d{4})-?(\d{2})-?(\d{2})(?:[-_T.]?(\d{2})[-:]?(\d{2})(?:[-:]?(\d{2}))?)?`)
+)
+
+// rotationName is what a file name says about its place in a rotation family
+type rotationName struct {
+	stem       string    // Name without rotation number, date or compression
+	number     int       // logrotate index, or -1
+	date       time.Time // Date or time in the name, zero if none
+	compressed bool
+	backup     bool // .old or .bak copy
+}
+
+// parseRotationName splits a file name into its family stem and rotation
+// markers, e.g. "app.log.2.gz", "app.log-20240115" and "app-2024-01-15.log"
+// all belong to the "app.log" family
+func parseRotationName(name string) rotationName {
+	r := rotationName{stem: name, number: -1}
+
+	lower := strings.ToLower(r.stem)
+	for _, ext := range compressedExts {
+		if strings.HasSuffix(lower, ext) && len(r.stem) > len(ext) {
+			r.stem = r.stem[:len(r.stem)-len(ext)]
+			r.compressed = true
+			break
+		}
+	}
+
+	for _, ext := range []string{".old", ".bak"} {
+		if strings.HasSuffix(strings.ToLower(r.stem), ext) && len(r.stem) > len(ext) {
+			r.stem = r.stem[:len(r.stem)-len(ext)]
+			r.backup = true
+			break
+		}
+	}
+
+	r.takeNumber()
+
+	// The last date-like run wins, so "2024-app.log-20240115" keeps its prefix
+	all := nameDateRe.FindAllStringSubmatchIndex(r.stem, -1)
+	for i := len(all) - 1; i >= 0; i-- {
+		m := all[i]
+		if t, ok := nameDate(r.stem, m); ok && m[0] > 0 {
+			r.date = t
+			r.stem = r.stem[:m[0]] + r.stem[m[1]:]
+			break
+		}
+	}
+
+	// Date and index together, as in logback's app.2024-01-15.0.log
+	if r.number < 0 {
+		r.takeNumber()
+	}
+	return r
+}
+
+// takeNumber strips a rotation index from the stem. Version-like names such
+// as release-1.5.txt are left alone.
+func (r *rotationName) takeNumber() {
+	isIndex := func(m []int) bool {
+		return m != nil && m[0] > 0 && (r.stem[m[0]-1] < '0' || r.stem[m[0]-1] > '9')
+	}
+	if m := numberedSuffixRe.FindStringSubmatchIndex(r.stem); isIndex(m) {
+		r.number, _ = strconv.Atoi(r.stem[m[2]:m[3]])
+		r.stem = r.stem[:m[0]]
+	} else if m := numberedInfixRe.FindStringSubmatchIndex(r.stem); isIndex(m) {
+		r.number, _ = strconv.Atoi(r.stem[m[2]:m[3]])
+		r.stem = r.stem[:m[0]] + r.stem[m[4]:m[5]]
+	}
+}
+
+// nameDate parses the date matched by nameDateRe, rejecting digit runs that
+// are not a valid date
+func nameDate(s string, m []int) (time.Time, bool) {
+	part := func(i int) string {
+		if m[2*i] < 0 {
+			return "00"
+		}
+		return s[m[2*i]:m[2*i+1]]
+	}
+	// Part of a longer digit run (e.g. an epoch or ID) is not a date
+	isDigit := func(c byte) bool { return c >= '0' && c <= '9' }
+	if (m[1] < len(s) && isDigit(s[m[1]])) || (m[0] > 0 && isDigit(s[m[0]-1])) {
+		return time.Time{}, false
+	}
+	t, err := time.ParseInLocation("2006 01 02 15 04 05",
+		strings.Join([]string{part(1), part(2), part(3), part(4), part(5), part(6)}, " "), time.Local)
+	if err != nil || t.Year() < 1990 {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// isLive reports whether a name has no rotation markers at all
+func (r rotationName) isLive() bool {
+	return r.number < 0 && r.date.IsZero() && !r.compressed && !r.backup
+}
+
+// isDatedCurrent reports whether a name carries only a date, as used by
+// loggers that write one file per day (app-2024-01-15.log) without a live name
+func (r rotationName) isDatedCurrent() bool {
+	return r.number < 0 && !r.date.IsZero() && !r.compressed && !r.backup
+}
+
+// orderRotations groups files into rotation families and sets their
+// rotation index, archive flag and time span. Within a family the live file
+// comes first (index 0), then rotations from newest to oldest: by the date
+// in the name, else by logrotate number, else by modification time. The
+// result is sorted newest data first across all families.
+func orderRotations(files []LogFile, source config.LogConfig) []LogFile {
+	families := make(map[string][]int)
+	names := make([]rotationName, len(files))
+	for i, f := range files {
+		names[i] = parseRotationName(filepath.Base(f.Path))
+		key := filepath.Join(filepath.Dir(f.Path), names[i].stem)
+		families[key] = append(families[key], i)
+		files[i].Family = names[i].stem
+	}
+
+	for _, members := range families {
+		sort.SliceStable(members, func(a, b int) bool {
+			x, y := names[members[a]], names[members[b]]
+			if x.isLive() != y.isLive() {
+				return x.isLive()
+			}
+			// Dates win over indexes: logback counts app.<date>.<i>.log up
+			// within a day, while logrotate counts app.log.<n> up with age
+			if !x.date.IsZero() && !y.date.IsZero() {
+				if !x.date.Equal(y.date) {
+					return x.date.After(y.date)
+				}
+			} else if x.number >= 0 && y.number >= 0 && x.number != y.number {
+				return x.number < y.number
+			}
+			return files[members[a]].ModTime.After(files[members[b]].ModTime)
+		})
+
+		// Dated names without a live file (app-2024-01-15.log): the newest
+		// uncompressed one is still being written
+		first := names[members[0]]
+		liveIndex := 0
+		if !first.isLive() && !first.isDatedCurrent() {
+			liveIndex = 1
+		}
+
+		var newer time.Time
+		for pos, i := range members {
+			f := &files[i]
+			f.Rotation = pos + liveIndex
+			f.IsArchive = f.Rotation > 0 || names[i].compressed
+			// A rotation cannot end after the file that replaced it
+			f.End = f.ModTime
+			if pos > 0 && f.End.After(newer) {
+				f.End = newer
+			}
+			newer = f.End
+		}
+		// Start at the first timestamp in the file, else where the previous
+		// rotation ended
+		for pos, i := range members {
+			files[i].Start = firstTimestamp(files[i], source)
+			if files[i].Start.IsZero() && pos+1 < len(members) {
+				files[i].Start = files[members[pos+1]].End
+			}
+		}
+	}
+
+	sort.SliceStable(files, func(a, b int) bool {
+		if !files[a].End.Equal(files[b].End) {
+			return files[a].End.After(files[b].End)
+		}
+		return files[a].Rotation < files[b].Rotation
+	})
+	return files
+}
+
+// spanCache remembers the first timestamp of files. Appending to a file does
+// not change it, so an entry holds while the file is the same one (inode)
+// and still starts with the same bytes.
+var spanCache = struct {
+	sync.Mutex
+	entries map[string]spanEntry
+}{entries: make(map[string]spanEntry)}
+
+type spanEntry struct {
+	info  os.FileInfo
+	head  []byte // First bytes of the file when it was probed
+	start time.Time
+}
+
+// firstTimestamp returns the timestamp of the first event in a file that has
+// one, or the zero time
+func firstTimestamp(f LogFile, source config.LogConfig) time.Time {
+	file, err := os.Open(f.Path)
+	if err != nil {
+		return time.Time{}
+	}
+	info, err := file.Stat()
+	head := make([]byte, spanHeadBytes)
+	n, _ := io.ReadFull(file, head)
+	head = head[:n]
+	file.Close()
+	if err != nil {
+		return time.Time{}
+	}
+
+	spanCache.Lock()
+	e, ok := spanCache.entries[f.Path]
+	spanCache.Unlock()
+	// Without a timestamp yet, one may still be written: probe again on growth
+	if ok && os.SameFile(e.info, info) && bytes.HasPrefix(head, e.head) &&
+		(!e.start.IsZero() || e.info.Size() == info.Size()) {
+		return e.start
+	}
+
+	var start time.Time
+	if parser, err := NewParser(source); err == nil {
+		if rc, err := openLogReader(f.Path); err == nil {
+			scanner := bufio.NewScanner(rc)
+			scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+			for n := 0; n < spanProbeLines && scanner.Scan(); n++ {
+				if r, ok := parser.Parse("", f.Path, scanner.Text()); ok {
+					start = r.Timestamp
+					break
+				}
+			}
+			rc.Close()
+		}
+	}
+
+	spanCache.Lock()
+	if len(spanCache.entries) >= maxDiscoveredFiles {
+		spanCache.entries = make(map[string]spanEntry) // Forget files rotated away long ago
+	}
+	spanCache.entries[f.Path] = spanEntry{info: info, head: head, start: start}
+	spanCache.Unlock()
+	return start
+}
+
+// familySiblings returns the files next to path that belong to its rotation
+// family, except excluded ones
+func familySiblings(path string, filter *fileFilter) []LogFile {
+	var files []LogFile
+
+	dir := filepath.Dir(path)
+	base := filepath.Base(path)
+	stem := parseRotationName(base).stem
+
+	siblings, _ := os.ReadDir(dir)
+	for _, s := range siblings {
+		if s.IsDir() || s.Name() == base || filter.excluded(s.Name()) {
+			continue
+		}
+		if parseRotationName(s.Name()).stem != stem {
+			continue
+		}
+		sInfo, err := s.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, LogFile{
+			Name:    s.Name(),
+			Path:    filepath.Join(dir, s.Name()),
+			Size:    sInfo.Size(),
+			ModTime: sInfo.ModTime(),
+		})
+	}
+	return files
+}
@@ -0,0 +1,167 @@
+package logs
+
+import (
+	"logmojo/internal/config"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseRotationName(t *testing.T) {
+	day := time.Date(2024, 1, 15, 0, 0, 0, 0, time.Local)
+	tests := []struct {
+		name string
+		want rotationName
+	}{
+		{"app.log", rotationName{stem: "app.log", number: -1}},
+		{"app.log.1", rotationName{stem: "app.log", number: 1}},
+		{"app.log.15", rotationName{stem: "app.log", number: 15}},
+		{"app.log.2.gz", rotationName{stem: "app.log", number: 2, compressed: true}},
+		{"app.log-20240115", rotationName{stem: "app.log", number: -1, date: day}},
+		{"app.log-20240115.gz", rotationName{stem: "app.log", number: -1, date: day, compressed: true}},
+		{"app.log.2024-01-15", rotationName{stem: "app.log", number: -1, date: day}},
+		{"app-2024-01-15.log", rotationName{stem: "app.log", number: -1, date: day}},
+		{"app-2024-01-15T10-00-00.log", rotationName{stem: "app.log", number: -1, date: day.Add(10 * time.Hour)}},
+		{"app.2024-01-15.0.log", rotationName{stem: "app.log", number: 0, date: day}},
+		{"app.1.log", rotationName{stem: "app.log", number: 1}},
+		{"app.log.old", rotationName{stem: "app.log", number: -1, backup: true}},
+		{"access.log.bak", rotationName{stem: "access.log", number: -1, backup: true}},
+		{"release-1.5.txt", rotationName{stem: "release-1.5.txt", number: -1}},
+		{"1700000000123.log", rotationName{stem: "1700000000123.log", number: -1}},
+		{"app.log-20241399", rotationName{stem: "app.log-20241399", number: -1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseRotationName(tt.name); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrderRotations(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	var files []LogFile
+	for i, name := range []string{"app.log.2.gz", "app.log", "app.log.1", "other.log"} {
+		files = append(files, LogFile{Name: name, Path: filepath.Join(dir, name), ModTime: now.Add(-time.Duration(i) * time.Hour)})
+	}
+
+	got := make(map[string]int)
+	for _, f := range orderRotations(files, config.LogConfig{}) {
+		got[f.Name] = f.Rotation
+		if f.IsArchive != (f.Rotation > 0) {
+			t.Errorf("%s: archive %v at rotation %d", f.Name, f.IsArchive, f.Rotation)
+		}
+	}
+	want := map[string]int{"app.log": 0, "app.log.1": 1, "app.log.2.gz": 2, "other.log": 0}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got rotations %v, want %v", got, want)
+	}
+}
+
+func TestFirstTimestampCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	write := func(flag int, text string) {
+		t.Helper()
+		f, err := os.OpenFile(path, flag|os.O_WRONLY|os.O_CREATE, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if _, err := f.WriteString(text); err != nil {
+			t.Fatal(err)
+		}
+	}
+	first := func() string {
+		t.Helper()
+		return firstTimestamp(LogFile{Path: path}, config.LogConfig{}).UTC().Format(time.RFC3339)
+	}
+	// mark changes the cached start, so a cache hit returns 2000-01-01
+	mark := func() {
+		spanCache.Lock()
+		e := spanCache.entries[path]
+		e.start = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+		spanCache.entries[path] = e
+		spanCache.Unlock()
+	}
+
+	write(os.O_TRUNC, "2024-01-15T10:00:00Z INFO started\n")
+	if got := first(); got != "2024-01-15T10:00:00Z" {
+		t.Fatalf("got %s", got)
+	}
+
+	// A live file keeps growing: the cached start still holds
+	mark()
+	write(os.O_APPEND, "2024-01-15T10:05:00Z INFO still running\n")
+	if got := first(); got != "2000-01-01T00:00:00Z" {
+		t.Errorf("after append: got %s", got)
+	}
+
+	// Truncated and rewritten in place
+	mark()
+	write(os.O_TRUNC, "2024-01-15T11:00:00Z INFO restarted\n")
+	if got := first(); got != "2024-01-15T11:00:00Z" {
+		t.Errorf("after rewrite: got %s", got)
+	}
+
+	// Replaced by a new file with the same first line
+	next := path + ".new"
+	if err := os.WriteFile(next, []byte("2024-01-15T11:00:00Z INFO restarted\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(next, path); err != nil {
+		t.Fatal(err)
+	}
+	mark()
+	if got := first(); got != "2024-01-15T11:00:00Z" {
+		t.Errorf("after replace: got %s", got)
+	}
+}
+
+func TestConfiguredFileApps(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"app.log", "app.log.1", "other.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("x\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	saved := config.AppConfigData
+	t.Cleanup(func() { config.AppConfigData = saved })
+	config.AppConfigData = config.Config{Apps: []config.AppConfig{
+		{Name: "shop", Logs: []config.LogConfig{{Name: "app", Path: filepath.Join(dir, "app.log")}}},
+		{Name: "elsewhere", Logs: []config.LogConfig{{Name: "app", Path: filepath.Join(t.TempDir(), "*.log")}}},
+	}}
+
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{filepath.Join(dir, "app.log"), []string{"shop"}},
+		{filepath.Join(dir, "app.log.1"), []string{"shop"}},
+		{filepath.Join(dir, "other.txt"), nil},
+		{"/etc/passwd", nil},
+	}
+	for _, tt := range tests {
+		if got := ConfiguredFileApps(tt.path); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.path, got, tt.want)
+		}
+	}
+
+	for _, tt := range []struct {
+		dir, path string
+		want      bool
+	}{
+		{"/var/log", "/var/log/app.log", true},
+		{"/var/log", "/var/log/nginx/access.log", true},
+		{"/var/log", "/var/logs/app.log", false},
+		{"/var/log", "/var/log/../../etc/passwd", false},
+		{"/var/log", "/etc/passwd", false},
+	} {
+		if got := withinDir(tt.dir, tt.path); got != tt.want {
+			t.Errorf("withinDir(%q, %q) = %v, want %v", tt.dir, tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,564 @@
+package logs
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"logmojo/internal/config"
+	"strings"
+	"time"
+)
+
+const (
+	defaultSearchLimit = 500
+	maxSearchLimit     = 5000             // Keeps a single page's memory bounded
+	searchTimeout      = 10 * time.Second // Time budget for a single page
+	rangeProbeEvery    = 256              // How often non-matching lines are checked against the time range
+	rangeSlack         = time.Minute      // How late a line may be logged before an ordered file stops being read
+)
+
+// SearchOptions holds the filters for a log search
+type SearchOptions struct {
+	Query  string
+	App    string
+	Log    string
+	File   string // Search only this file instead of every file of App/Log
+	Level  string
+	Regex  bool      // Treat Query as a plain regular expression instead of the query language
+	Filter string    // Extra query-language expression ANDed with Query, e.g. status:500
+	From   time.Time // Zero means no lower bound
+	To     time.Time // Zero means no upper bound
+	Limit  int
+	Cursor string // Opaque token from a previous SearchPage.Next
+	Facets int    // Number of top values per field to count over all matches; 0 disables
+}
+
+// SearchPage is one page of search results. Results are ordered newest file
+// first and, within a file, newest line first. Files are not merged by time:
+// the lines of files written at the same time, such as those of several apps
+// or hosts, come one file after the other.
+type SearchPage struct {
+	Results      []LogResult `json:"results"`
+	Next         string      `json:"next,omitempty"` // Cursor for the following page, empty when done
+	FilesScanned int         `json:"files_scanned"`  // Files fully or partially read for this page
+	FilesTotal   int         `json:"files_total"`    // Files matching the app/log/time filters
+	Truncated    bool        `json:"truncated"`      // More matches exist beyond this page
+	TimedOut     bool        `json:"timed_out"`      // The page stopped early because of the time budget
+	Facets       *Facets     `json:"facets,omitempty"`
+}
+
+// hasTimeRange reports whether the search is bounded in time
+func (o SearchOptions) hasTimeRange() bool {
+	return !o.From.IsZero() || !o.To.IsZero()
+}
+
+// inRange reports whether ts falls inside the [From, To] window
+func (o SearchOptions) inRange(ts time.Time) bool {
+	if !o.From.IsZero() && ts.Before(o.From) {
+		return false
+	}
+	if !o.To.IsZero() && ts.After(o.To) {
+		return false
+	}
+	return true
+}
+
+// pastRange reports whether ts is so far past the end of the window that no
+// later line of a file written in time order can be in it. Concurrent writers
+// may interleave lines a little out of order, hence rangeSlack.
+func (o SearchOptions) pastRange(ts time.Time) bool {
+	return !o.To.IsZero() && ts.After(o.To.Add(rangeSlack))
+}
+
+// searchTarget is a file to search together with the app it belongs to
+type searchTarget struct {
+	Path   string
+	App    string
+	Source config.LogConfig
+	Redact []string // Apps whose redaction rules apply: App, then every other app with the file
+	Size   int64
+	Start  time.Time
+	End    time.Time
+}
+
+// searchCursor marks where the next page resumes: matches in the file at
+// Path strictly before line Line (0 means the end of the file). Size is how
+// large the file was, to tell a file rotated since from the same file grown.
+// The cursor also pins the time window of the first page, so relative times
+// such as now-1h do not move between pages: journal line numbers count from
+// --since.
+type searchCursor struct {
+	Path string `json:"p"`
+	Line int    `json:"l"`
+	Size int64  `json:"s,omitempty"`
+	From int64  `json:"from,omitempty"` // Unix nanoseconds, 0 for no bound
+	To   int64  `json:"to,omitempty"`
+}
+
+// errStaleCursor is returned for a cursor whose file was rotated or removed
+// since the previous page, as its line numbers no longer point at the same lines
+var errStaleCursor = errors.New("the log files changed since the previous page, search again")
+
+func encodeCursor(target searchTarget, opts SearchOptions, line int) string {
+	cur := searchCursor{Path: target.Path, Line: line, Size: target.Size}
+	if !opts.From.IsZero() {
+		cur.From = opts.From.UnixNano()
+	}
+	if !opts.To.IsZero() {
+		cur.To = opts.To.UnixNano()
+	}
+	data, _ := json.Marshal(cur)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(token string) (searchCursor, error) {
+	var cur searchCursor
+	if token == "" {
+		return cur, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return cur, fmt.Errorf("invalid cursor")
+	}
+	if err := json.Unmarshal(data, &cur); err != nil {
+		return cur, fmt.Errorf("invalid cursor")
+	}
+	return cur, nil
+}
+
+// pin returns opts with the time window of the page the cursor came from
+func (cur searchCursor) pin(opts SearchOptions) SearchOptions {
+	if cur.From != 0 {
+		opts.From = time.Unix(0, cur.From)
+	}
+	if cur.To != 0 {
+		opts.To = time.Unix(0, cur.To)
+	}
+	return opts
+}
+
+// locate returns the index of the cursor's file among targets. Files added
+// since the previous page only move it; a file that is gone, or shrank
+// because it was rotated, gives errStaleCursor.
+func (cur searchCursor) locate(targets []searchTarget) (int, error) {
+	if cur.Path == "" {
+		return 0, nil
+	}
+	for i, t := range targets {
+		if t.Path == cur.Path {
+			if t.Size < cur.Size {
+				return 0, errStaleCursor
+			}
+			return i, nil
+		}
+	}
+	return 0, errStaleCursor
+}
+
+// resolveTargets lists the files to search, newest first. A single File must
+// belong to the App/Log entry, whose parser and rules it is read with.
+func resolveTargets(opts SearchOptions) ([]searchTarget, error) {
+	if opts.File != "" {
+		logCfg, _ := FindLogConfig(opts.App, opts.Log)
+		f, ok := findLogFile(opts.App, opts.Log, opts.File)
+		if !ok {
+			return nil, fmt.Errorf("file is not a file of %s/%s", opts.App, opts.Log)
+		}
+		redact := redactionApps(opts.App, ConfiguredFileApps(opts.File))
+		return []searchTarget{{Path: f.Path, App: opts.App, Source: logCfg, Redact: redact, Size: f.Size, Start: f.Start, End: f.End}}, nil
+	}
+
+	var targets []searchTarget
+	owners := make(map[string][]string)
+	listed := make(map[string]bool)
+	for _, app := range config.Apps() {
+		if opts.App != "" && app.Name != opts.App {
+			continue
+		}
+		for _, l := range app.Logs {
+			if opts.Log != "" && l.Name != opts.Log {
+				continue
+			}
+
+			// Resolve actual files for this entry (newest first, rotations in sequence)
+			files, _ := ListFiles(app.Name, l.Name)
+			listed[app.Name+"/"+l.Name] = true
+			for _, f := range files {
+				owners[f.Path] = append(owners[f.Path], app.Name)
+				// Skip files whose time span lies outside the window
+				if !opts.From.IsZero() && f.ModTime.Before(opts.From) {
+					continue
+				}
+				if !opts.To.IsZero() && !l.Unordered && !f.Start.IsZero() && f.Start.After(opts.To) {
+					continue
+				}
+				// Add all files (including archives) for search
+				targets = append(targets, searchTarget{Path: f.Path, App: app.Name, Source: l, Size: f.Size, Start: f.Start, End: f.End})
+			}
+		}
+	}
+
+	// A file may also be part of apps that were not searched, whose rules
+	// apply to it as well
+	paths := make([]string, len(targets))
+	for i, t := range targets {
+		paths[i] = t.Path
+	}
+	addFileApps(owners, paths, func(app string, l config.LogConfig) bool { return listed[app+"/"+l.Name] })
+	for i := range targets {
+		targets[i].Redact = redactionApps(targets[i].App, owners[targets[i].Path])
+	}
+	return targets, nil
+}
+
+// redactionApps returns app followed by the other apps of owners
+func redactionApps(app string, owners []string) []string {
+	apps := []string{app}
+	for _, a := range owners {
+		if !containsString(apps, a) {
+			apps = append(apps, a)
+		}
+	}
+	return apps
+}
+
+// Search searches plain and compressed log files natively (no grep subprocess)
+// and returns one page of results. Pass the returned Next back as Cursor to
+// continue through older matches across every rotated file. The page stops
+// early with TimedOut set when its time budget runs out, and returns ctx's
+// error when ctx is cancelled.
+func Search(ctx context.Context, opts SearchOptions) (SearchPage, error) {
+	budget, cancel := context.WithTimeout(ctx, searchTimeout)
+	defer cancel()
+
+	return search(ctx, budget, opts, func(page *SearchPage, results []LogResult) error {
+		page.Results = append(page.Results, results...)
+		return nil
+	})
+}
+
+// SearchStream runs the same search as Search but hands the results of each
+// file to emit as soon as that file is scanned, newest first, instead of
+// collecting them. There is no time budget; cancel ctx to stop. The returned
+// page holds the totals and the cursor for the next page but no Results.
+func SearchStream(ctx context.Context, opts SearchOptions, emit func(page *SearchPage, results []LogResult) error) (SearchPage, error) {
+	return search(ctx, ctx, opts, emit)
+}
+
+// search runs a page of a search. budget bounds the time spent (it is ctx
+// or derived from it); emit receives the results of each scanned file.
+func search(ctx, budget context.Context, opts SearchOptions, emit func(page *SearchPage, results []LogResult) error) (SearchPage, error) {
+	page := SearchPage{Results: []LogResult{}}
+
+	cur, err := decodeCursor(opts.Cursor)
+	if err != nil {
+		return page, err
+	}
+	opts = cur.pin(opts)
+
+	targets, err := resolveTargets(opts)
+	if err != nil {
+		return page, err
+	}
+	page.FilesTotal = len(targets)
+	start, err := cur.locate(targets)
+	if err != nil {
+		return page, err
+	}
+	if len(targets) == 0 {
+		log.Printf("[LOGS] No files found for app=%s, log=%s", opts.App, opts.Log)
+		return page, nil
+	}
+
+	query, err := CompileQuery(opts)
+	if err != nil {
+		return page, err
+	}
+
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	if limit > maxSearchLimit {
+		limit = maxSearchLimit
+	}
+
+	log.Printf("[LOGS] Searching %d files for query=%s, level=%s", len(targets), opts.Query, opts.Level)
+
+	found := 0
+	for i := start; i < len(targets); i++ {
+		before := 0
+		if i == start {
+			before = cur.Line
+		}
+
+		hits, more, err := scanFile(budget, targets[i], query, opts, before, limit-found)
+		if err != nil && budget.Err() != nil {
+			if ctx.Err() != nil {
+				log.Printf("[LOGS] Search cancelled after %d/%d files", page.FilesScanned, page.FilesTotal)
+				return page, ctx.Err()
+			}
+			log.Printf("[LOGS] Search timeout after %s, returning partial page", searchTimeout)
+			page.TimedOut = true
+			page.Truncated = true
+			page.Next = encodeCursor(targets[i], opts, before)
+			break
+		}
+		page.FilesScanned++
+		if err != nil {
+			log.Printf("[LOGS] Failed to search %s: %v", targets[i].Path, err)
+			continue
+		}
+
+		// Hits come oldest first; pages list newest first
+		results := make([]LogResult, 0, len(hits))
+		for j := len(hits) - 1; j >= 0; j-- {
+			results = append(results, hits[j].result)
+		}
+		found += len(results)
+
+		if more {
+			page.Truncated = true
+			page.Next = encodeCursor(targets[i], opts, hits[0].line)
+		} else if found >= limit && i+1 < len(targets) {
+			page.Truncated = true
+			page.Next = encodeCursor(targets[i+1], opts, 0)
+		}
+
+		if err := emit(&page, results); err != nil {
+			return page, err
+		}
+		if more || found >= limit {
+			break
+		}
+	}
+
+	if opts.Facets > 0 {
+		facets, err := searchFacets(ctx, targets, query, opts, opts.Facets)
+		if err != nil {
+			return page, err
+		}
+		page.Facets = facets
+	}
+
+	log.Printf("[LOGS] Returning %d results from %d/%d files", found, page.FilesScanned, page.FilesTotal)
+	return page, nil
+}
+
+// searchHit is a matching line together with its 1-based line number
+type searchHit struct {
+	result LogResult
+	line   int
+}
+
+// hitRing keeps only the newest hits so memory stays bounded
+type hitRing struct {
+	hits    []searchHit
+	start   int
+	dropped bool
+}
+
+func (r *hitRing) push(hit searchHit) {
+	if len(r.hits) < cap(r.hits) {
+		r.hits = append(r.hits, hit)
+		return
+	}
+	r.hits[r.start] = hit
+	r.start = (r.start + 1) % len(r.hits)
+	r.dropped = true
+}
+
+// ordered returns the kept hits oldest first
+func (r *hitRing) ordered() []searchHit {
+	return append(r.hits[r.start:], r.hits[:r.start]...)
+}
+
+// scanFile streams one (possibly compressed) file and returns, oldest first,
+// the last want matching events that start before line before (0 means no
+// bound). more reports whether older matches were dropped to honour want.
+func scanFile(ctx context.Context, target searchTarget, query *Query, opts SearchOptions, before, want int) ([]searchHit, bool, error) {
+	ring := hitRing{hits: make([]searchHit, 0, want)}
+	err := walkFile(ctx, target, query, opts, before, func(hit searchHit, hasTimestamp bool) {
+		ring.push(hit)
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return ring.ordered(), ring.dropped, nil
+}
+
+// walkFile streams one (possibly compressed) file and calls visit, oldest
+// first, for every event that starts before line before (0 means no bound)
+// and passes the query and the time and level filters
+func walkFile(ctx context.Context, target searchTarget, query *Query, opts SearchOptions, before int, visit func(hit searchHit, hasTimestamp bool)) error {
+	parser, err := NewParser(target.Source)
+	if err != nil {
+		return err
+	}
+	rule, err := sourceMultiline(target.Source, parser)
+	if err != nil {
+		return err
+	}
+
+	var rc io.ReadCloser
+	if IsJournal(target.Source) {
+		// Let journalctl narrow the window instead of reading the whole journal
+		rc, err = openJournal(ctx, target.Source, opts.From, opts.To, false, 0)
+	} else {
+		rc, err = openLogReader(target.Path)
+	}
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	redact := target.Redact
+	if len(redact) == 0 {
+		redact = []string{target.App}
+	}
+
+	// Received logs are stored as they arrive, not in time order, so only
+	// other files stop being read past the end of the window
+	ordered := !target.Source.Unordered
+
+	// handle evaluates one complete event and reports whether the scan can stop
+	handle := func(ev logEvent) bool {
+		// Queries and everything counted from the hits see redacted
+		// content only, so a search cannot confirm a masked value
+		parsed := lazyResult{parser: parser, app: target.App, redact: redact, path: target.Path, line: ev.text}
+		if !query.Match(redactText(parser.Payload(ev.text), redact, false), parsed.get) {
+			return false
+		}
+		result := parsed.get()
+		result.Line = ev.line
+		result.Offset = ev.offset
+		keep, stop := opts.accept(result, parsed.hasTimestamp)
+		if keep {
+			visit(searchHit{result: result, line: ev.line}, parsed.hasTimestamp)
+		}
+		return stop && ordered
+	}
+
+	reader := bufio.NewReaderSize(rc, 64*1024)
+	grouper := lineGrouper{rule: rule}
+	lineNo := 0
+	var offset int64
+	stopped := false
+
+	for !stopped {
+		line, readErr := reader.ReadString('\n')
+		if len(line) > 0 {
+			lineNo++
+			lineOffset := offset
+			offset += int64(len(line))
+			// Cursors always point at the first line of an event, so the
+			// pending event is complete when we get there
+			if before > 0 && lineNo >= before {
+				break
+			}
+			line = strings.TrimRight(line, "\r\n")
+
+			// Check for cancellation periodically rather than on every line
+			if lineNo%4096 == 0 && ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			if ev, ok := grouper.push(line, lineNo, lineOffset); ok && handle(ev) {
+				stopped = true
+				break
+			}
+
+			if ordered && opts.hasTimeRange() && lineNo%rangeProbeEvery == 0 {
+				if r, ok := parser.Parse(target.App, target.Path, line); ok && opts.pastRange(r.Timestamp) {
+					break
+				}
+			}
+		}
+
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+
+	if !stopped {
+		if ev, ok := grouper.flush(); ok {
+			handle(ev)
+		}
+	}
+	// journalctl only reports a missing unit or unreadable journal on exit
+	if IsJournal(target.Source) {
+		return rc.Close()
+	}
+	return nil
+}
+
+// accept applies the time and level filters to a matching line. stop is true
+// once the line is well past the end of the time window, after which nothing
+// later in a file written in time order can match.
+func (o SearchOptions) accept(result LogResult, hasTimestamp bool) (keep, stop bool) {
+	if o.hasTimeRange() {
+		if !hasTimestamp {
+			return false, false
+		}
+		if o.pastRange(result.Timestamp) {
+			return false, true
+		}
+		if !o.inRange(result.Timestamp) {
+			return false, false
+		}
+	}
+	if o.Level != "" && result.Level != o.Level {
+		return false, false
+	}
+	return true, false
+}
+
+// CompileQuery compiles the search expression in the mode requested by opts
+// and combines it with the Filter expression
+func CompileQuery(opts SearchOptions) (*Query, error) {
+	var query *Query
+	var err error
+	if opts.Regex {
+		query, err = RegexQuery(opts.Query)
+	} else {
+		query, err = ParseQuery(opts.Query)
+	}
+	if err != nil || opts.Filter == "" {
+		return query, err
+	}
+
+	filter, err := ParseQuery(opts.Filter)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter: %w", err)
+	}
+	return query.And(filter), nil
+}
+
+// lazyResult parses a line into a LogResult redacted with the rules of the
+// redact apps, at most once, on first use
+type lazyResult struct {
+	parser       *Parser
+	app, path    string
+	redact       []string
+	line         string
+	done         bool
+	result       LogResult
+	hasTimestamp bool
+}
+
+func (l *lazyResult) get() LogResult {
+	if !l.done {
+		l.result, l.hasTimestamp = l.parser.Parse(l.app, l.path, l.line)
+		redactResult(&l.result, l.redact)
+		l.done = true
+	}
+	return l.result
+}
@@ -0,0 +1,183 @@
+package logs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"logmojo/internal/config"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useFileApp configures a single app reading one file with the given lines
+func useFileApp(t *testing.T, source config.LogConfig, lines ...string) {
+	t.Helper()
+	source.Name = "app"
+	source.Path = filepath.Join(t.TempDir(), "app.log")
+	if err := os.WriteFile(source.Path, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	saved := config.AppConfigData
+	t.Cleanup(func() { config.AppConfigData = saved })
+	config.AppConfigData = config.Config{Apps: []config.AppConfig{{Name: "shop", Logs: []config.LogConfig{source}}}}
+}
+
+func TestSearchTimeRangeOrder(t *testing.T) {
+	at := func(s string) time.Time {
+		ts, err := time.Parse(time.RFC3339, "2024-01-15T"+s+"Z")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ts
+	}
+
+	tests := []struct {
+		name      string
+		unordered bool
+		lines     []string
+		from, to  string
+		count     int
+	}{
+		{"unordered source is read in full", true,
+			[]string{"2024-01-15T10:00:00Z INFO a", "2024-01-15T12:00:00Z INFO b", "2024-01-15T10:30:00Z INFO c"},
+			"09:00:00", "11:00:00", 2},
+		{"ordered source stops past the window", false,
+			[]string{"2024-01-15T10:00:00Z INFO a", "2024-01-15T12:00:00Z INFO b", "2024-01-15T10:30:00Z INFO c"},
+			"09:00:00", "11:00:00", 1},
+		{"ordered source tolerates slightly late lines", false,
+			[]string{"2024-01-15T10:00:00Z INFO a", "2024-01-15T11:00:30Z INFO b", "2024-01-15T10:59:59Z INFO c"},
+			"09:00:00", "11:00:00", 2},
+		{"lower bound", false,
+			[]string{"2024-01-15T08:00:00Z INFO a", "2024-01-15T09:30:00Z INFO b", "no timestamp"},
+			"09:00:00", "11:00:00", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useFileApp(t, config.LogConfig{Unordered: tt.unordered}, tt.lines...)
+			page, err := Search(context.Background(), SearchOptions{App: "shop", From: at(tt.from), To: at(tt.to)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(page.Results) != tt.count {
+				t.Errorf("got %d results, want %d: %+v", len(page.Results), tt.count, page.Results)
+			}
+		})
+	}
+}
+
+// useRotatedApp configures app shop/app with app.log and its rotations
+// app.log.1 and app.log.2.gz holding events 7-9, 4-6 and 1-3
+func useRotatedApp(t *testing.T) string {
+	t.Helper()
+	event := func(n int) string {
+		return fmt.Sprintf("2024-01-15T10:00:%02dZ INFO event %d\n", n, n)
+	}
+	var files [3]string
+	for n := 1; n <= 9; n++ {
+		files[2-(n-1)/3] += event(n)
+	}
+	useFileApp(t, config.LogConfig{}, strings.TrimSuffix(files[0], "\n"))
+	path := config.AppConfigData.Apps[0].Logs[0].Path
+
+	if err := os.WriteFile(path+".1", []byte(files[1]), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte(files[2]))
+	zw.Close()
+	if err := os.WriteFile(path+".2.gz", gz.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSearchPagesAcrossFiles(t *testing.T) {
+	useRotatedApp(t)
+
+	for _, limit := range []int{1, 2, 3, 4, 10} {
+		var got []string
+		opts := SearchOptions{App: "shop", Limit: limit}
+		for pages := 0; ; pages++ {
+			if pages > 10 {
+				t.Fatalf("limit %d: cursor does not advance", limit)
+			}
+			page, err := Search(context.Background(), opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(page.Results) > limit {
+				t.Errorf("limit %d: page of %d", limit, len(page.Results))
+			}
+			for _, r := range page.Results {
+				got = append(got, r.Message[strings.Index(r.Message, "event"):])
+			}
+			if page.Next == "" {
+				break
+			}
+			opts.Cursor = page.Next
+		}
+		var want []string
+		for n := 9; n >= 1; n-- {
+			want = append(want, fmt.Sprintf("event %d", n))
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("limit %d: got %v, want %v", limit, got, want)
+		}
+	}
+}
+
+func TestSearchStaleCursor(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(path string) error
+	}{
+		{"file rotated", func(path string) error {
+			if err := os.Rename(path+".1", path+".2"); err != nil {
+				return err
+			}
+			if err := os.Rename(path, path+".1"); err != nil {
+				return err
+			}
+			return os.WriteFile(path, []byte("2024-01-15T10:00:10Z INFO event 10\n"), 0644)
+		}},
+		{"file removed", func(path string) error {
+			return os.Remove(path)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := useRotatedApp(t)
+			page, err := Search(context.Background(), SearchOptions{App: "shop", Limit: 1})
+			if err != nil || page.Next == "" {
+				t.Fatalf("first page: %+v, %v", page, err)
+			}
+			if err := tt.change(path); err != nil {
+				t.Fatal(err)
+			}
+			_, err = Search(context.Background(), SearchOptions{App: "shop", Limit: 1, Cursor: page.Next})
+			if err != errStaleCursor {
+				t.Errorf("got %v, want %v", err, errStaleCursor)
+			}
+		})
+	}
+
+	// A file that only grew keeps its cursor
+	path := useRotatedApp(t)
+	page, _ := Search(context.Background(), SearchOptions{App: "shop", Limit: 1})
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("2024-01-15T10:00:10Z INFO event 10\n")
+	f.Close()
+	page, err = Search(context.Background(), SearchOptions{App: "shop", Limit: 1, Cursor: page.Next})
+	if err != nil || len(page.Results) != 1 || !strings.HasSuffix(page.Results[0].Message, "event 8") {
+		t.Errorf("after append: %+v, %v", page.Results, err)
+	}
+}
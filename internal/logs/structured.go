@@ -0,0 +1,265 @@
+package logs
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Well-known keys for the level, timestamp and message of structured lines
+var (
+	levelKeys     = []string{"level", "lvl", "severity", "loglevel", "log.level", "levelname"}
+	timestampKeys = []string{"time", "ts", "timestamp", "@timestamp", "datetime", "t"}
+	messageKeys   = []string{"msg", "message", "@message", "log"}
+)
+
+// structuredEntry is what the JSON and logfmt parsers extract from a line
+type structuredEntry struct {
+	level     string
+	timestamp time.Time
+	message   string
+	fields    map[string]string
+}
+
+// IsTimestampKey reports whether a structured field is read as the timestamp
+func IsTimestampKey(key string) bool {
+	for _, k := range timestampKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// IsReservedKey reports whether a structured field is read as the level,
+// timestamp or message
+func IsReservedKey(key string) bool {
+	for _, keys := range [][]string{levelKeys, timestampKeys, messageKeys} {
+		for _, k := range keys {
+			if k == key {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseStructured parses a line in the given format ("json", "logfmt", or
+// "auto" to detect either). ok is false when the line is not structured.
+func parseStructured(line, format string) (structuredEntry, bool) {
+	var fields map[string]string
+	var ok bool
+
+	switch format {
+	case "json":
+		fields, ok = parseJSONFields(line)
+	case "logfmt":
+		fields, ok = parseLogfmtFields(line, false)
+	case "auto":
+		if strings.HasPrefix(strings.TrimSpace(line), "{") {
+			fields, ok = parseJSONFields(line)
+		} else if fields, ok = parseLogfmtFields(line, true); ok && !hasAnyKey(fields, levelKeys, timestampKeys, messageKeys) {
+			// Plenty of plain lines contain a=b pairs; only trust logfmt with known keys
+			ok = false
+		}
+	}
+	if !ok {
+		return structuredEntry{}, false
+	}
+
+	entry := structuredEntry{fields: fields}
+	if key, v := takeKey(fields, levelKeys); key != "" {
+		entry.level = normalizeLevel(v)
+	}
+	if key, v := takeKey(fields, timestampKeys); key != "" {
+		if ts, ok := parseStructuredTime(v); ok {
+			entry.timestamp = ts
+		} else {
+			fields[key] = v // Keep unparseable values visible
+		}
+	}
+	if key, v := takeKey(fields, messageKeys); key != "" {
+		entry.message = v
+	}
+	return entry, true
+}
+
+// hasAnyKey reports whether fields contains any of the keys in the given lists
+func hasAnyKey(fields map[string]string, keyLists ...[]string) bool {
+	for _, keys := range keyLists {
+		for _, k := range keys {
+			if _, ok := fields[k]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// takeKey removes and returns the first present key of keys
+func takeKey(fields map[string]string, keys []string) (string, string) {
+	for _, k := range keys {
+		if v, ok := fields[k]; ok {
+			delete(fields, k)
+			return k, v
+		}
+	}
+	return "", ""
+}
+
+// parseJSONFields parses a JSON object line, flattening nested objects into dotted keys
+func parseJSONFields(line string) (map[string]string, bool) {
+	var obj map[string]interface{}
+	dec := json.NewDecoder(strings.NewReader(line))
+	dec.UseNumber()
+	if err := dec.Decode(&obj); err != nil {
+		return nil, false
+	}
+	fields := make(map[string]string, len(obj))
+	flattenJSON("", obj, fields)
+	return fields, true
+}
+
+func flattenJSON(prefix string, obj map[string]interface{}, out map[string]string) {
+	for k, v := range obj {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		switch val := v.(type) {
+		case map[string]interface{}:
+			flattenJSON(key, val, out)
+		case string:
+			out[key] = val
+		case nil:
+			out[key] = ""
+		case json.Number:
+			out[key] = val.String()
+		case bool:
+			out[key] = strconv.FormatBool(val)
+		default:
+			data, _ := json.Marshal(val)
+			out[key] = string(data)
+		}
+	}
+}
+
+// parseLogfmtFields parses key=value pairs; values may be double-quoted.
+// ok is false unless the whole line consists of pairs. strict rejects bare
+// keys, which logfmt allows but which make plain text look like logfmt.
+func parseLogfmtFields(line string, strict bool) (map[string]string, bool) {
+	fields := make(map[string]string)
+	i := 0
+	n := len(line)
+
+	for i < n {
+		for i < n && line[i] == ' ' {
+			i++
+		}
+		if i >= n {
+			break
+		}
+
+		start := i
+		for i < n && line[i] != '=' && line[i] != ' ' && line[i] != '"' {
+			i++
+		}
+		key := line[start:i]
+		if key == "" {
+			return nil, false
+		}
+		if i >= n || line[i] != '=' {
+			// Bare keys are allowed in logfmt and mean true
+			if strict || (i < n && line[i] == '"') {
+				return nil, false
+			}
+			fields[key] = "true"
+			continue
+		}
+		i++ // '='
+
+		if i < n && line[i] == '"' {
+			var sb strings.Builder
+			i++
+			closed := false
+			for i < n {
+				c := line[i]
+				if c == '\\' && i+1 < n {
+					switch line[i+1] {
+					case 'n':
+						sb.WriteByte('\n')
+					case 't':
+						sb.WriteByte('\t')
+					default:
+						sb.WriteByte(line[i+1])
+					}
+					i += 2
+					continue
+				}
+				if c == '"' {
+					closed = true
+					i++
+					break
+				}
+				sb.WriteByte(c)
+				i++
+			}
+			if !closed {
+				return nil, false
+			}
+			fields[key] = sb.String()
+		} else {
+			start = i
+			for i < n && line[i] != ' ' {
+				i++
+			}
+			fields[key] = line[start:i]
+		}
+	}
+
+	return fields, len(fields) >= 2
+}
+
+// normalizeLevel maps the many spellings of log levels (including numeric
+// pino/bunyan levels and single letters) onto INFO, WARN, ERROR, DEBUG, FATAL and TRACE
+func normalizeLevel(v string) string {
+	switch strings.ToUpper(strings.TrimSpace(v)) {
+	case "TRACE", "T", "10":
+		return "TRACE"
+	case "DEBUG", "DBG", "D", "20":
+		return "DEBUG"
+	case "INFO", "INFORMATION", "NOTICE", "I", "30":
+		return "INFO"
+	case "WARN", "WARNING", "W", "40":
+		return "WARN"
+	case "ERROR", "ERR", "E", "50":
+		return "ERROR"
+	case "FATAL", "CRITICAL", "CRIT", "PANIC", "EMERG", "ALERT", "SEVERE", "F", "60":
+		return "FATAL"
+	}
+	return strings.ToUpper(v)
+}
+
+// parseStructuredTime parses a timestamp value: RFC 3339, any format known to
+// parseTimestamp, or Unix seconds/milliseconds/nanoseconds
+func parseStructuredTime(v string) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+		return t, true
+	}
+	if f, err := strconv.ParseFloat(v, 64); err == nil && f > 0 {
+		switch {
+		case f > 1e17: // nanoseconds
+			return time.Unix(0, int64(f)), true
+		case f > 1e11: // milliseconds
+			return time.UnixMilli(int64(f)), true
+		default: // seconds, possibly fractional
+			sec := int64(f)
+			return time.Unix(sec, int64((f-float64(sec))*1e9)), true
+		}
+	}
+	if t, _ := parseTimestamp(v); !t.IsZero() {
+		return t, true
+	}
+	return time.Time{}, false
+}
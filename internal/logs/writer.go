@@ -0,0 +1,188 @@
+package logs
+
+import (
+	"container/list"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Files a RotatingFiles set keeps open at once
+const maxOpenWriters = 256
+
+// RotatingFile appends to a log file and rotates it logrotate style
+// (app.log -> app.log.1 -> app.log.2 ...) once it reaches maxSize, keeping
+// maxFiles rotations. Rotated files are found by ListFiles like any others.
+type RotatingFile struct {
+	mu       sync.Mutex
+	path     string
+	maxSize  int64
+	maxFiles int
+	file     *os.File
+	size     int64
+}
+
+func NewRotatingFile(path string, maxSize int64, maxFiles int) *RotatingFile {
+	return &RotatingFile{path: path, maxSize: maxSize, maxFiles: maxFiles}
+}
+
+// Write appends p in one write, so lines from concurrent writers never interleave
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *RotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(f.path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+func (f *RotatingFile) rotate() error {
+	f.file.Close()
+	f.file = nil
+
+	if f.maxFiles > 0 {
+		os.Remove(fmt.Sprintf("%s.%d", f.path, f.maxFiles))
+		for i := f.maxFiles - 1; i >= 1; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", f.path, i), fmt.Sprintf("%s.%d", f.path, i+1))
+		}
+		if err := os.Rename(f.path, f.path+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Truncate(f.path, 0); err != nil {
+		return err
+	}
+	return f.open()
+}
+
+// Close closes the file; the next Write opens it again
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// RotatingFiles writes to a changing set of rotating files, such as one per
+// host or app, opening them on first use. There is only ever one
+// RotatingFile per path, so two never rotate the same file.
+type RotatingFiles struct {
+	mu       sync.Mutex
+	files    map[string]*list.Element // Of *openWriter, in lru
+	lru      *list.List               // Most recently used first
+	maxSize  int64
+	maxFiles int
+}
+
+// openWriter is a file of a RotatingFiles set and the writes in progress
+type openWriter struct {
+	path string
+	file *RotatingFile
+	refs int
+}
+
+func NewRotatingFiles(maxSize int64, maxFiles int) *RotatingFiles {
+	return &RotatingFiles{files: make(map[string]*list.Element), lru: list.New(), maxSize: maxSize, maxFiles: maxFiles}
+}
+
+// Write appends p to the file at path
+func (s *RotatingFiles) Write(path string, p []byte) error {
+	s.mu.Lock()
+	w := s.acquire(path)
+	s.mu.Unlock()
+
+	_, err := w.file.Write(p)
+
+	s.mu.Lock()
+	w.refs--
+	s.mu.Unlock()
+	return err
+}
+
+// acquire returns the writer of path with a write in progress counted.
+// s.mu must be held.
+func (s *RotatingFiles) acquire(path string) *openWriter {
+	if e, ok := s.files[path]; ok {
+		s.lru.MoveToFront(e)
+		w := e.Value.(*openWriter)
+		w.refs++
+		return w
+	}
+
+	// Too many senders: close the least recently used files nobody is
+	// writing to rather than run out of descriptors
+	for e := s.lru.Back(); e != nil && s.lru.Len() >= maxOpenWriters; {
+		prev := e.Prev()
+		if old := e.Value.(*openWriter); old.refs == 0 {
+			old.file.Close()
+			s.lru.Remove(e)
+			delete(s.files, old.path)
+		}
+		e = prev
+	}
+
+	w := &openWriter{path: path, file: NewRotatingFile(path, s.maxSize, s.maxFiles), refs: 1}
+	s.files[path] = s.lru.PushFront(w)
+	return w
+}
+
+// Close closes all open files; a later Write opens its file again
+func (s *RotatingFiles) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range s.files {
+		e.Value.(*openWriter).file.Close()
+	}
+}
+
+// SafeFileName turns a name sent by a client, such as a host or app, into a
+// file name that cannot escape its directory
+func SafeFileName(s string) string {
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		}
+		return '_'
+	}, s)
+	s = strings.Trim(s, ".")
+	if s == "" {
+		return "unknown"
+	}
+	if len(s) > 64 {
+		s = s[:64]
+	}
+	return s
+}
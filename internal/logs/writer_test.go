@@ -0,0 +1,92 @@
+package logs
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestRotatingFilesConcurrent(t *testing.T) {
+	const (
+		paths   = maxOpenWriters + 44
+		writers = 8
+		lines   = 5 // Per writer and path
+	)
+	dir := t.TempDir()
+	// Small files, so every path rotates while others are being evicted
+	files := NewRotatingFiles(256, 20)
+
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for n := 0; n < lines; n++ {
+				for i := 0; i < paths; i++ {
+					// Each writer walks the paths in its own order
+					p := (i + w*37) % paths
+					line := fmt.Sprintf("writer %d line %d to file %d\n", w, n, p)
+					if err := files.Write(filepath.Join(dir, fmt.Sprintf("%03d.log", p)), []byte(line)); err != nil {
+						t.Error(err)
+						return
+					}
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	files.Close()
+
+	for p := 0; p < paths; p++ {
+		path := filepath.Join(dir, fmt.Sprintf("%03d.log", p))
+		matches, err := filepath.Glob(path + "*")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var all []byte
+		for _, m := range matches {
+			data, err := os.ReadFile(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			all = append(all, data...)
+		}
+		if got := bytes.Count(all, []byte("\n")); got != writers*lines {
+			t.Fatalf("%s: %d lines in %d files, want %d", path, got, len(matches), writers*lines)
+		}
+		if want := []byte(fmt.Sprintf(" to file %d\n", p)); bytes.Count(all, want) != writers*lines {
+			t.Errorf("%s: holds lines of other files or torn lines", path)
+		}
+	}
+}
+
+func TestRotatingFilesKeepBusyWriters(t *testing.T) {
+	dir := t.TempDir()
+	files := NewRotatingFiles(0, 0)
+	busy := filepath.Join(dir, "busy.log")
+
+	// A write to busy.log is in progress while the set fills up
+	files.mu.Lock()
+	w := files.acquire(busy)
+	files.mu.Unlock()
+	for i := 0; i < 2*maxOpenWriters; i++ {
+		if err := files.Write(filepath.Join(dir, fmt.Sprintf("%03d.log", i)), []byte("x\n")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if files.lru.Len() > maxOpenWriters {
+		t.Errorf("%d writers open", files.lru.Len())
+	}
+
+	files.mu.Lock()
+	again := files.acquire(busy)
+	w.refs--
+	again.refs--
+	files.mu.Unlock()
+	if again.file != w.file {
+		t.Error("a second writer was created for a file being written")
+	}
+}
@@ -33,7 +33,7 @@ type ServiceStatus struct {
 func GetAllServices() ([]ServiceStatus, error) {
 	var services []ServiceStatus
 
-	for _, app := range config.AppConfigData.Apps {
+	for _, app := range config.Apps() {
 		for _, svc := range app.Services {
 			if !svc.Enabled {
 				continue
@@ -0,0 +1,207 @@
+package syslog
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var facilities = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "clock",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+// Severities 0 (emerg) to 7 (debug), as logmojo levels
+var severityLevels = []string{"FATAL", "FATAL", "FATAL", "ERROR", "WARN", "INFO", "INFO", "DEBUG"}
+
+// Message is one received syslog message
+type Message struct {
+	Facility  string
+	Severity  int
+	Timestamp time.Time
+	Host      string
+	App       string
+	ProcID    string
+	MsgID     string
+	// StructuredData holds RFC 5424 SD-ELEMENTs by SD-ID
+	StructuredData map[string]map[string]string
+	Text           string
+}
+
+// Level is the logmojo level of the message's severity
+func (m Message) Level() string {
+	return severityLevels[m.Severity]
+}
+
+// Parse parses an RFC 5424 or RFC 3164 message. Messages without a valid
+// PRI are rejected; missing RFC 3164 parts fall back to sender and arrival
+// time, as rsyslog does.
+func Parse(data []byte, received time.Time) (Message, error) {
+	s := strings.TrimRight(string(data), "\r\n\x00")
+	if !strings.HasPrefix(s, "<") {
+		return Message{}, fmt.Errorf("missing PRI")
+	}
+	end := strings.IndexByte(s, '>')
+	if end < 2 || end > 4 {
+		return Message{}, fmt.Errorf("invalid PRI")
+	}
+	pri, err := strconv.Atoi(s[1:end])
+	if err != nil || pri < 0 || pri > 191 {
+		return Message{}, fmt.Errorf("invalid PRI")
+	}
+
+	m := Message{Facility: facilities[pri/8], Severity: pri % 8, Timestamp: received}
+	rest := s[end+1:]
+	if strings.HasPrefix(rest, "1 ") {
+		err = m.parse5424(rest[2:])
+	} else {
+		m.parse3164(rest, received)
+	}
+	return m, err
+}
+
+// parse5424 reads TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+func (m *Message) parse5424(s string) error {
+	var fields [5]string
+	for i := range fields {
+		var ok bool
+		fields[i], s, ok = strings.Cut(s, " ")
+		if !ok && i < 4 {
+			return fmt.Errorf("truncated RFC 5424 header")
+		}
+	}
+	if fields[0] != "-" {
+		ts, err := time.Parse(time.RFC3339Nano, fields[0])
+		if err != nil {
+			return fmt.Errorf("invalid timestamp %q", fields[0])
+		}
+		m.Timestamp = ts
+	}
+	m.Host = nilValue(fields[1])
+	m.App = nilValue(fields[2])
+	m.ProcID = nilValue(fields[3])
+	m.MsgID = nilValue(fields[4])
+
+	if strings.HasPrefix(s, "-") {
+		s = s[1:]
+	} else if strings.HasPrefix(s, "[") {
+		sd, rest, err := parseStructuredData(s)
+		if err != nil {
+			return err
+		}
+		m.StructuredData, s = sd, rest
+	}
+	s = strings.TrimPrefix(s, " ")
+	m.Text = strings.TrimPrefix(s, "\ufeff") // UTF-8 BOM
+	return nil
+}
+
+func nilValue(s string) string {
+	if s == "-" {
+		return ""
+	}
+	return s
+}
+
+// parseStructuredData reads [id name="value" ...] elements up to the message
+func parseStructuredData(s string) (map[string]map[string]string, string, error) {
+	sd := make(map[string]map[string]string)
+	for strings.HasPrefix(s, "[") {
+		s = s[1:]
+		idEnd := strings.IndexAny(s, " ]")
+		if idEnd <= 0 {
+			return nil, "", fmt.Errorf("invalid structured data")
+		}
+		params := make(map[string]string)
+		sd[s[:idEnd]] = params
+		s = s[idEnd:]
+
+		for {
+			s = strings.TrimLeft(s, " ")
+			if strings.HasPrefix(s, "]") {
+				s = s[1:]
+				break
+			}
+			eq := strings.Index(s, `="`)
+			if eq <= 0 {
+				return nil, "", fmt.Errorf("invalid structured data")
+			}
+			name := s[:eq]
+			s = s[eq+2:]
+
+			// Values escape '"', '\' and ']' with a backslash
+			var value strings.Builder
+			closed := false
+			for i := 0; i < len(s); i++ {
+				if s[i] == '\\' && i+1 < len(s) && strings.IndexByte(`"\]`, s[i+1]) >= 0 {
+					value.WriteByte(s[i+1])
+					i++
+					continue
+				}
+				if s[i] == '"' {
+					s = s[i+1:]
+					closed = true
+					break
+				}
+				value.WriteByte(s[i])
+			}
+			if !closed {
+				return nil, "", fmt.Errorf("unterminated structured data value")
+			}
+			params[name] = value.String()
+		}
+	}
+	return sd, s, nil
+}
+
+// RFC 3164 timestamps, with the high-precision variant some daemons send
+var bsdLayouts = []string{time.RFC3339Nano, time.StampMicro, time.Stamp}
+
+// parse3164 reads "Mmm dd hh:mm:ss HOSTNAME TAG[PID]: MSG". The timestamp
+// has no year or zone, so it is taken as local time in the current year (or
+// the previous one just after New Year).
+func (m *Message) parse3164(s string, received time.Time) {
+	for _, layout := range bsdLayouts {
+		n := len(layout)
+		if layout != time.RFC3339Nano && len(s) < n {
+			continue
+		}
+		if layout == time.RFC3339Nano {
+			n = strings.IndexByte(s, ' ')
+			if n < 0 {
+				continue
+			}
+		}
+		ts, err := time.ParseInLocation(layout, s[:n], time.Local)
+		if err != nil {
+			continue
+		}
+		if layout != time.RFC3339Nano {
+			ts = ts.AddDate(received.Year(), 0, 0)
+			if ts.After(received.Add(24 * time.Hour)) {
+				ts = ts.AddDate(-1, 0, 0)
+			}
+		}
+		m.Timestamp = ts
+		s = strings.TrimPrefix(s[n:], " ")
+
+		// A hostname has no colon or bracket; otherwise it is already the tag
+		if host, rest, ok := strings.Cut(s, " "); ok && !strings.ContainsAny(host, ":[") {
+			m.Host, s = host, rest
+		}
+		break
+	}
+
+	// TAG is up to 32 alphanumerics, optionally followed by [PID], then ':'
+	if colon := strings.Index(s, ": "); colon > 0 && colon <= 48 && !strings.Contains(s[:colon], " ") {
+		tag := s[:colon]
+		if open := strings.IndexByte(tag, '['); open > 0 && strings.HasSuffix(tag, "]") {
+			m.ProcID = tag[open+1 : len(tag)-1]
+			tag = tag[:open]
+		}
+		m.App, s = tag, s[colon+2:]
+	}
+	m.Text = s
+}
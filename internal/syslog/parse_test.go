@@ -0,0 +1,118 @@
+package syslog
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	received := time.Date(2024, 3, 10, 12, 0, 0, 0, time.Local)
+	local := func(month time.Month, day, hour, min, sec int) time.Time {
+		return time.Date(2024, month, day, hour, min, sec, 0, time.Local)
+	}
+
+	tests := []struct {
+		name string
+		in   string
+		want Message
+	}{
+		{"rfc5424",
+			`<165>1 2024-03-10T11:59:00.003Z web1 shop 8710 ID47 - Order placed`,
+			Message{Facility: "local4", Severity: 5, Timestamp: time.Date(2024, 3, 10, 11, 59, 0, 3e6, time.UTC),
+				Host: "web1", App: "shop", ProcID: "8710", MsgID: "ID47", Text: "Order placed"}},
+		{"rfc5424 nil values",
+			`<14>1 - - - - - -`,
+			Message{Facility: "user", Severity: 6, Timestamp: received}},
+		{"rfc5424 structured data",
+			`<13>1 2024-03-10T11:59:00+01:00 web1 shop - - [origin ip="10.0.0.1"][meta note="a \"quoted\\\] value"] ` + "\ufeff" + `Done`,
+			Message{Facility: "user", Severity: 5, Timestamp: time.Date(2024, 3, 10, 10, 59, 0, 0, time.UTC),
+				Host: "web1", App: "shop", Text: "Done",
+				StructuredData: map[string]map[string]string{
+					"origin": {"ip": "10.0.0.1"},
+					"meta":   {"note": `a "quoted\] value`},
+				}}},
+		{"rfc5424 structured data only",
+			`<13>1 - web1 shop - - [hb@1]`,
+			Message{Facility: "user", Severity: 5, Timestamp: received, Host: "web1", App: "shop",
+				StructuredData: map[string]map[string]string{"hb@1": {}}}},
+		{"rfc3164",
+			"<38>Mar 10 11:59:00 web1 sshd[4321]: Accepted publickey for deploy\n",
+			Message{Facility: "auth", Severity: 6, Timestamp: local(3, 10, 11, 59, 0),
+				Host: "web1", App: "sshd", ProcID: "4321", Text: "Accepted publickey for deploy"}},
+		{"rfc3164 padded day",
+			"<30>Mar  9 08:00:00 web1 cron: job done",
+			Message{Facility: "daemon", Severity: 6, Timestamp: local(3, 9, 8, 0, 0),
+				Host: "web1", App: "cron", Text: "job done"}},
+		{"rfc3164 high precision",
+			"<30>Mar 10 11:59:00.250000 web1 app: tick",
+			Message{Facility: "daemon", Severity: 6, Timestamp: local(3, 10, 11, 59, 0).Add(250 * time.Millisecond),
+				Host: "web1", App: "app", Text: "tick"}},
+		{"rfc3164 rfc3339 timestamp",
+			"<30>2024-03-10T11:59:00Z web1 app: tick",
+			Message{Facility: "daemon", Severity: 6, Timestamp: time.Date(2024, 3, 10, 11, 59, 0, 0, time.UTC),
+				Host: "web1", App: "app", Text: "tick"}},
+		{"rfc3164 without hostname",
+			"<30>Mar 10 11:59:00 app[7]: tick",
+			Message{Facility: "daemon", Severity: 6, Timestamp: local(3, 10, 11, 59, 0),
+				App: "app", ProcID: "7", Text: "tick"}},
+		{"rfc3164 without timestamp or tag",
+			"<11>something broke: badly",
+			Message{Facility: "user", Severity: 3, Timestamp: received, Text: "something broke: badly"}},
+		{"rfc3164 late in the year",
+			"<30>Dec 31 23:59:59 web1 app: old",
+			Message{Facility: "daemon", Severity: 6, Timestamp: time.Date(2023, 12, 31, 23, 59, 59, 0, time.Local),
+				Host: "web1", App: "app", Text: "old"}},
+		{"pri 0",
+			"<0>panic",
+			Message{Facility: "kern", Severity: 0, Timestamp: received, Text: "panic"}},
+		{"pri 191",
+			"<191>debug",
+			Message{Facility: "local7", Severity: 7, Timestamp: received, Text: "debug"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse([]byte(tt.in), received)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Timestamp.Equal(tt.want.Timestamp) {
+				t.Errorf("timestamp %v, want %v", got.Timestamp, tt.want.Timestamp)
+			}
+			got.Timestamp, tt.want.Timestamp = time.Time{}, time.Time{}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"no pri",
+		"<>empty",
+		"<192>too high",
+		"<-1>negative",
+		"<12345>too long",
+		"<1a>not a number",
+		"<13>1 2024-03-10T11:59:00Z web1",
+		"<13>1 yesterday web1 app - - - text",
+		`<13>1 - web1 app - - [id name=unquoted] text`,
+		`<13>1 - web1 app - - [id name="unterminated] text`,
+		`<13>1 - web1 app - - [] text`,
+	} {
+		if m, err := Parse([]byte(in), time.Now()); err == nil {
+			t.Errorf("Parse(%q) = %+v, want an error", in, m)
+		}
+	}
+}
+
+func TestMessageLevel(t *testing.T) {
+	want := []string{"FATAL", "FATAL", "FATAL", "ERROR", "WARN", "INFO", "INFO", "DEBUG"}
+	for severity, level := range want {
+		if got := (Message{Severity: severity}).Level(); got != level {
+			t.Errorf("severity %d: got %s, want %s", severity, got, level)
+		}
+	}
+}
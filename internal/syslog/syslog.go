@@ -0,0 +1,257 @@
+// Package syslog receives syslog messages over UDP and TCP and stores them
+// as JSON lines under a directory, one file per sending host and app, so they
+// can be searched, tailed and alerted on like any other log source.
+package syslog
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"logmojo/internal/config"
+	"logmojo/internal/logs"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	maxMessageSize = 64 * 1024
+	// Digits of an octet count up to maxMessageSize
+	maxLengthDigits = 5
+	tcpIdleTimeout  = 10 * time.Minute
+	// File in the top directory for hosts past max_hosts, read by "All hosts" only
+	otherHostsFile = "other-hosts.log"
+)
+
+var (
+	files   *logs.RotatingFiles
+	appName string
+	// Hosts with a log entry of their own, by directory name. Any datagram
+	// can claim a new host name, so there are at most max (0 for no limit).
+	hosts = struct {
+		sync.Mutex
+		registered map[string]bool
+		max        int
+		full       bool // The refusal of a host was logged
+	}{registered: make(map[string]bool)}
+)
+
+var errBadFrame = errors.New("bad frame length")
+
+// Start registers the receiver's log sources and starts the listeners.
+func Start(cfg config.SyslogConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if cfg.UDPAddr == "" && cfg.TCPAddr == "" {
+		return fmt.Errorf("syslog: no udp_addr or tcp_addr")
+	}
+	dir, err := filepath.Abs(cfg.Dir)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	files = logs.NewRotatingFiles(int64(cfg.MaxFileSize)*1024*1024, cfg.MaxFiles)
+	appName = cfg.App
+	hosts.max = cfg.MaxHosts
+	register(dir)
+
+	if cfg.UDPAddr != "" {
+		conn, err := net.ListenPacket("udp", cfg.UDPAddr)
+		if err != nil {
+			return fmt.Errorf("syslog: %w", err)
+		}
+		log.Printf("[SYSLOG] Listening on udp %s", cfg.UDPAddr)
+		go serveUDP(conn, dir)
+	}
+	if cfg.TCPAddr != "" {
+		ln, err := net.Listen("tcp", cfg.TCPAddr)
+		if err != nil {
+			return fmt.Errorf("syslog: %w", err)
+		}
+		log.Printf("[SYSLOG] Listening on tcp %s", cfg.TCPAddr)
+		go serveTCP(ln, dir)
+	}
+	return nil
+}
+
+// register adds the received logs to the configured app: all hosts together,
+// and each host that has sent messages before
+func register(dir string) {
+	sources := []config.LogConfig{{Name: "All hosts", Path: dir, Recursive: true, Format: "json", Unordered: true}}
+	entries, _ := os.ReadDir(dir)
+	hosts.Lock()
+	for _, e := range entries {
+		if e.IsDir() && (hosts.max <= 0 || len(hosts.registered) < hosts.max) {
+			hosts.registered[e.Name()] = true
+			sources = append(sources, config.LogConfig{Name: e.Name(), Path: filepath.Join(dir, e.Name()), Format: "json", Unordered: true})
+		}
+	}
+	hosts.Unlock()
+	config.RegisterLogs(appName, sources...)
+}
+
+// registerHost gives a host that sends for the first time its own log entry.
+// It returns false once max_hosts are registered, as the messages of further
+// hosts only go to "All hosts".
+func registerHost(name, dir string) bool {
+	hosts.Lock()
+	defer hosts.Unlock()
+	if hosts.registered[name] {
+		return true
+	}
+	if hosts.max > 0 && len(hosts.registered) >= hosts.max {
+		if !hosts.full {
+			hosts.full = true
+			log.Printf("[SYSLOG] %d hosts registered, messages of new hosts such as %s go to %s only", hosts.max, name, otherHostsFile)
+		}
+		return false
+	}
+	hosts.registered[name] = true
+	config.RegisterLogs(appName, config.LogConfig{Name: name, Path: filepath.Join(dir, name), Format: "json", Unordered: true})
+	log.Printf("[SYSLOG] New host %s", name)
+	return true
+}
+
+func serveUDP(conn net.PacketConn, dir string) {
+	buf := make([]byte, maxMessageSize)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			log.Printf("[SYSLOG] UDP listener stopped: %v", err)
+			return
+		}
+		store(buf[:n], addr, dir)
+	}
+}
+
+func serveTCP(ln net.Listener, dir string) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			log.Printf("[SYSLOG] TCP listener stopped: %v", err)
+			return
+		}
+		go handleTCP(conn, dir)
+	}
+}
+
+// handleTCP reads octet-counted ("<len> <msg>", RFC 6587) or newline
+// delimited messages from one connection
+func handleTCP(conn net.Conn, dir string) {
+	defer conn.Close()
+	r := bufio.NewReaderSize(conn, maxMessageSize)
+	for {
+		conn.SetReadDeadline(time.Now().Add(tcpIdleTimeout))
+		first, err := r.Peek(1)
+		if err != nil {
+			return
+		}
+
+		var msg []byte
+		if first[0] >= '0' && first[0] <= '9' {
+			size, err := readFrameLength(r)
+			if err == errBadFrame {
+				log.Printf("[SYSLOG] Bad frame length from %s, closing", conn.RemoteAddr())
+			}
+			if err != nil {
+				return
+			}
+			msg = make([]byte, size)
+			if _, err := io.ReadFull(r, msg); err != nil {
+				return
+			}
+		} else {
+			line, err := r.ReadSlice('\n')
+			if err != nil && len(line) == 0 {
+				return
+			}
+			msg = line
+		}
+		store(msg, conn.RemoteAddr(), dir)
+	}
+}
+
+// readFrameLength reads the "<len> " prefix of an octet-counted frame. At most
+// maxLengthDigits digits are read, so a peer that never sends the space
+// cannot make the reader buffer without bound.
+func readFrameLength(r *bufio.Reader) (int, error) {
+	size := 0
+	for digits := 0; ; digits++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if b == ' ' && digits > 0 {
+			if size <= 0 || size > maxMessageSize {
+				return 0, errBadFrame
+			}
+			return size, nil
+		}
+		if b < '0' || b > '9' || digits == maxLengthDigits {
+			return 0, errBadFrame
+		}
+		size = size*10 + int(b-'0')
+	}
+}
+
+// record is how a message is stored; the log sources read these keys back as
+// timestamp, level, message and fields
+type record struct {
+	Time     time.Time                    `json:"time"`
+	Level    string                       `json:"level"`
+	Host     string                       `json:"host"`
+	App      string                       `json:"appname,omitempty"` // "app" is the logmojo app in queries
+	ProcID   string                       `json:"pid,omitempty"`
+	MsgID    string                       `json:"msgid,omitempty"`
+	Facility string                       `json:"facility"`
+	SD       map[string]map[string]string `json:"sd,omitempty"`
+	Message  string                       `json:"msg"`
+}
+
+func store(data []byte, addr net.Addr, dir string) {
+	if len(strings.TrimSpace(string(data))) == 0 {
+		return
+	}
+	m, err := Parse(data, time.Now())
+	if err != nil {
+		log.Printf("[SYSLOG] Dropped message from %s: %v", addr, err)
+		return
+	}
+	if m.Host == "" {
+		m.Host, _, _ = net.SplitHostPort(addr.String())
+	}
+
+	line, err := json.Marshal(record{
+		Time:     m.Timestamp,
+		Level:    m.Level(),
+		Host:     m.Host,
+		App:      m.App,
+		ProcID:   m.ProcID,
+		MsgID:    m.MsgID,
+		Facility: m.Facility,
+		SD:       m.StructuredData,
+		Message:  m.Text,
+	})
+	if err != nil {
+		return
+	}
+
+	host := logs.SafeFileName(m.Host)
+	path := filepath.Join(dir, host, logs.SafeFileName(m.App)+".log")
+	if !registerHost(host, dir) {
+		path = filepath.Join(dir, otherHostsFile)
+	}
+	if err := files.Write(path, append(line, '\n')); err != nil {
+		log.Printf("[SYSLOG] Failed to write %s: %v", path, err)
+	}
+}
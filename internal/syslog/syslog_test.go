@@ -0,0 +1,109 @@
+package syslog
+
+import (
+	"bufio"
+	"logmojo/internal/config"
+	"logmojo/internal/logs"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadFrameLength(t *testing.T) {
+	tests := []struct {
+		in   string
+		size int
+		ok   bool
+	}{
+		{"12 <13>hello", 12, true},
+		{"65536 x", 65536, true},
+		{"65537 x", 0, false}, // Longer than maxMessageSize
+		{"0 x", 0, false},
+		{"123456 x", 0, false},
+		{"00000000000001 x", 0, false},
+		{"12x", 0, false},
+		{"1" + strings.Repeat("9", 1<<20), 0, false}, // Never sends the space
+		{"12", 0, false},
+	}
+	for _, tt := range tests {
+		src := strings.NewReader(tt.in)
+		size, err := readFrameLength(bufio.NewReaderSize(src, 16))
+		if (err == nil) != tt.ok || size != tt.size {
+			t.Errorf("readFrameLength(%.20q) = %d, %v", tt.in, size, err)
+		}
+		// A bad length is rejected after a few bytes, not the whole input
+		if read := len(tt.in) - src.Len(); read > 16 {
+			t.Errorf("readFrameLength(%.20q) read %d bytes", tt.in, read)
+		}
+	}
+}
+
+// useHosts starts from an empty config with the given hosts registered
+func useHosts(t *testing.T, max int, registered ...string) {
+	t.Helper()
+	saved := config.AppConfigData
+	t.Cleanup(func() {
+		config.AppConfigData = saved
+		hosts.registered = make(map[string]bool)
+		hosts.max, hosts.full = 0, false
+	})
+	config.AppConfigData = config.Config{}
+	appName = "Syslog"
+	hosts.registered = make(map[string]bool)
+	for _, name := range registered {
+		hosts.registered[name] = true
+	}
+	hosts.max = max
+}
+
+func TestRegisterHostOnce(t *testing.T) {
+	useHosts(t, 0, "old-host")
+
+	dir := t.TempDir()
+	registerHost("router-1", dir)
+	registerHost("router-1", dir)
+	registerHost("old-host", dir)
+
+	apps := config.Apps()
+	if len(apps) != 1 || apps[0].Name != "Syslog" || len(apps[0].Logs) != 1 {
+		t.Fatalf("unexpected apps %+v", apps)
+	}
+	if l := apps[0].Logs[0]; l.Name != "router-1" || l.Format != "json" {
+		t.Errorf("unexpected log %+v", l)
+	}
+}
+
+func TestRegisterHostCap(t *testing.T) {
+	useHosts(t, 2)
+	dir := t.TempDir()
+	files = logs.NewRotatingFiles(0, 0)
+	t.Cleanup(files.Close)
+
+	addr := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 514}
+	for _, host := range []string{"router-1", "router-2", "spoofed-1", "spoofed-2", "router-1"} {
+		store([]byte("<13>Jan 15 10:00:00 "+host+" sshd: hello"), addr, dir)
+	}
+
+	apps := config.Apps()
+	if len(apps) != 1 || len(apps[0].Logs) != 2 {
+		t.Fatalf("unexpected apps %+v", apps)
+	}
+	entries, _ := os.ReadDir(dir)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if want := []string{"other-hosts.log", "router-1", "router-2"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("files %v, want %v", names, want)
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, otherHostsFile))
+	if !strings.Contains(string(data), `"host":"spoofed-1"`) || !strings.Contains(string(data), `"host":"spoofed-2"`) {
+		t.Errorf("%s holds %s", otherHostsFile, data)
+	}
+	if !hosts.full {
+		t.Error("refusal not recorded")
+	}
+}
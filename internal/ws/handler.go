@@ -3,65 +3,171 @@ package ws
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"log"
 	"logmojo/internal/config"
 	"logmojo/internal/logs"
 	"logmojo/internal/metrics"
 	"logmojo/internal/processes"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/gofiber/contrib/websocket"
 )
 
-func Handler(c *websocket.Conn) {
-	appName := c.Query("app")
-	logName := c.Query("log")
+const (
+	// Log sources one live tail may follow
+	maxTailSources = 50
+	// Most past lines a live tail may start with, per file
+	maxBackfill = 1000
+	// Lines per second sent to one client; a burst of maxBackfill passes
+	maxTailRate = 200
+	// Messages waiting for a slow client before lines are dropped
+	tailQueueSize = 256
+	// How often dropped lines are reported
+	dropReportInterval = time.Second
+)
 
-	var logPath string
-	// Find the log path from config
-	for _, app := range config.AppConfigData.Apps {
-		if app.Name == appName {
-			for _, l := range app.Logs {
-				if l.Name == logName {
-					// Get the actual file path (handle directories)
-					files, err := logs.ListFiles(appName, logName)
-					if err == nil && len(files) > 0 {
-						// Use the first non-archive file
-						for _, f := range files {
-							if !f.IsArchive {
-								logPath = f.Path
-								break
-							}
-						}
-						if logPath == "" && len(files) > 0 {
-							logPath = files[0].Path // Fallback to first file
-						}
-					} else {
-						// Direct file path
-						logPath = l.Path
-					}
-					break
-				}
-			}
-		}
+// Types of live tail messages, besides the logs.TailRotated and
+// logs.TailTruncated notices
+const (
+	msgLine  = "line"
+	msgError = "error"
+	msgInfo  = "info"
+)
+
+// tailSource is one log source followed by the live tail
+type tailSource struct {
+	app    string
+	log    string
+	config config.LogConfig
+	parser *logs.Parser
+}
+
+// lineMessage is a parsed entry, tagged with the log it came from
+type lineMessage struct {
+	Type string `json:"type"`
+	logs.LogResult
+	Log string `json:"log"`
+}
+
+// noticeMessage is an error, an info such as dropped lines, or a rotated or
+// truncated file
+type noticeMessage struct {
+	Type    string `json:"type"`
+	Message string `json:"message,omitempty"`
+	App     string `json:"app,omitempty"`
+	Log     string `json:"log,omitempty"`
+	File    string `json:"file,omitempty"`
+	From    string `json:"from,omitempty"`
+	Dropped int    `json:"dropped,omitempty"`
+}
+
+// tailLine is an event or a stream error from one of the tailed sources
+type tailLine struct {
+	source int
+	event  logs.TailEvent
+	err    error
+}
+
+// tokenBucket allows rate lines per second with bursts of up to burst lines
+type tokenBucket struct {
+	rate, burst, tokens float64
+	last                time.Time
+}
+
+func (b *tokenBucket) allow() bool {
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// closeWithError sends an error message and closes the connection
+func closeWithError(c *websocket.Conn, msg string) {
+	data, _ := json.Marshal(noticeMessage{Type: msgError, Message: msg})
+	c.WriteMessage(websocket.TextMessage, data)
+	c.Close()
+}
+
+// Handler streams new entries of one or more log sources, merged into one
+// stream. Sources are app and log (all logs of the app when log is empty),
+// or sources, a JSON array of {"app", "log"} objects. backfill sends the last
+// lines of each file first. q (query language, or a regular expression with
+// regex=true), filter and level drop entries on the server before they are
+// sent.
+//
+// Every message is a JSON object with a type: "line" (the LogResult fields
+// of an entry), "rotated" or "truncated" (a followed file changed), "info"
+// or "error". Lines beyond maxTailRate, or that a slow client cannot take,
+// are dropped and counted in an info message.
+func Handler(c *websocket.Conn) {
+	sources, err := tailSources(c)
+	if err != nil {
+		closeWithError(c, err.Error())
+		return
+	}
+	if len(sources) == 0 {
+		closeWithError(c, "Log file not found or not accessible")
+		return
 	}
 
-	if logPath == "" {
-		c.WriteMessage(websocket.TextMessage, []byte("Log file not found or not accessible"))
-		c.Close()
+	query, err := logs.CompileQuery(logs.SearchOptions{
+		Query:  c.Query("q"),
+		Regex:  c.Query("regex") == "true",
+		Filter: c.Query("filter"),
+	})
+	if err != nil {
+		closeWithError(c, err.Error())
 		return
 	}
+	level := strings.ToUpper(c.Query("level"))
+	backfill, _ := strconv.Atoi(c.Query("backfill"))
+	if backfill > maxBackfill {
+		backfill = maxBackfill
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	lines := make(chan string)
+	lines := make(chan tailLine)
+	var wg sync.WaitGroup
+	for i, s := range sources {
+		wg.Add(1)
+		go func(i int, s tailSource) {
+			defer wg.Done()
+			log.Printf("Starting stream for: %s/%s", s.app, s.log)
+			out := make(chan logs.TailEvent)
+			go func() {
+				// StreamLog reports a broken parser block itself
+				if err := logs.StreamLog(ctx, s.config, backfill, out); err != nil {
+					log.Printf("Error streaming log %s/%s: %v", s.app, s.log, err)
+					select {
+					case lines <- tailLine{source: i, err: err}:
+					case <-ctx.Done():
+					}
+				}
+				close(out)
+			}()
+			for ev := range out {
+				select {
+				case lines <- tailLine{source: i, event: ev}:
+				case <-ctx.Done():
+				}
+			}
+		}(i, s)
+	}
 	go func() {
-		log.Printf("Starting stream for: %s", logPath)
-		if err := logs.StreamLog(ctx, logPath, lines); err != nil {
-			log.Printf("Error streaming log %s: %v", logPath, err)
-			c.WriteMessage(websocket.TextMessage, []byte("Error: "+err.Error()))
-		}
+		wg.Wait()
 		close(lines)
 	}()
 
@@ -75,11 +181,146 @@ func Handler(c *websocket.Conn) {
 		}
 	}()
 
-	for line := range lines {
-		if err := c.WriteMessage(websocket.TextMessage, []byte(line)); err != nil {
-			break
+	// A writer goroutine, so a slow client makes lines drop instead of
+	// holding up the files being followed
+	queue := make(chan []byte, tailQueueSize)
+	writerDone := make(chan struct{})
+	go func() {
+		defer close(writerDone)
+		for data := range queue {
+			if err := c.WriteMessage(websocket.TextMessage, data); err != nil {
+				cancel()
+				return
+			}
+		}
+	}()
+	defer func() {
+		close(queue)
+		<-writerDone
+	}()
+
+	// Notices are never dropped
+	enqueue := func(msg interface{}) bool {
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return true
+		}
+		select {
+		case queue <- data:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	bucket := &tokenBucket{rate: maxTailRate, burst: maxBackfill, tokens: maxBackfill, last: time.Now()}
+	dropped := 0
+	report := time.NewTicker(dropReportInterval)
+	defer report.Stop()
+
+	for {
+		var line tailLine
+		var ok bool
+		select {
+		case line, ok = <-lines:
+		case <-report.C:
+			if dropped > 0 {
+				msg := fmt.Sprintf("%d lines dropped", dropped)
+				if !enqueue(noticeMessage{Type: msgInfo, Message: msg, Dropped: dropped}) {
+					return
+				}
+				dropped = 0
+			}
+			continue
+		}
+		if !ok {
+			return
+		}
+
+		s := sources[line.source]
+		ev := line.event
+		switch {
+		case line.err != nil:
+			if !enqueue(noticeMessage{Type: msgError, Message: line.err.Error(), App: s.app, Log: s.log}) {
+				return
+			}
+		case ev.Kind != logs.TailLine:
+			if !enqueue(noticeMessage{Type: ev.Kind, App: s.app, Log: s.log, File: ev.File, From: ev.From}) {
+				return
+			}
+		default:
+			// Send the parsed entry so clients get the source's level and timestamp
+			result, hasTimestamp := s.parser.Parse(s.app, ev.File, ev.Text)
+			if !hasTimestamp {
+				result.Timestamp = time.Now()
+			}
+			if level != "" && result.Level != level {
+				continue
+			}
+			// Match redacted content only, so a query cannot confirm a masked value
+			logs.RedactResult(&result)
+			payload := logs.RedactPayload(s.app, s.parser.Payload(ev.Text))
+			if !query.Match(payload, func() logs.LogResult { return result }) {
+				continue
+			}
+			if !bucket.allow() {
+				dropped++
+				continue
+			}
+			result.Offset = ev.Offset
+			data, err := json.Marshal(lineMessage{Type: msgLine, LogResult: result, Log: s.log})
+			if err != nil {
+				continue
+			}
+			select {
+			case queue <- data:
+			default:
+				dropped++
+			}
+		}
+	}
+}
+
+// tailSources resolves the log sources to follow from the request parameters
+func tailSources(c *websocket.Conn) ([]tailSource, error) {
+	type sourceParam struct {
+		App string `json:"app"`
+		Log string `json:"log"`
+	}
+	var params []sourceParam
+	if raw := c.Query("sources"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &params); err != nil {
+			return nil, fmt.Errorf("invalid sources: %v", err)
+		}
+	} else if c.Query("app") != "" {
+		params = []sourceParam{{App: c.Query("app"), Log: c.Query("log")}}
+	}
+
+	var sources []tailSource
+	seen := make(map[string]bool)
+	for _, p := range params {
+		for _, app := range config.Apps() {
+			if app.Name != p.App {
+				continue
+			}
+			for _, l := range app.Logs {
+				if (p.Log != "" && l.Name != p.Log) || seen[app.Name+"/"+l.Name] {
+					continue
+				}
+				parser, err := logs.NewParser(l)
+				if err != nil {
+					return nil, fmt.Errorf("%s/%s: %v", app.Name, l.Name, err)
+				}
+				if len(sources) == maxTailSources {
+					log.Printf("Live tail limited to %d sources", maxTailSources)
+					return sources, nil
+				}
+				seen[app.Name+"/"+l.Name] = true
+				sources = append(sources, tailSource{app: app.Name, log: l.Name, config: l, parser: parser})
+			}
 		}
 	}
+	return sources, nil
 }
 
 type ProcessData struct {
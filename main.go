@@ -12,8 +12,11 @@ import (
 	"logmojo/internal/api"
 	"logmojo/internal/config"
 	"logmojo/internal/db"
+	"logmojo/internal/ingest"
 	"logmojo/internal/logger"
+	"logmojo/internal/logs"
 	"logmojo/internal/metrics"
+	"logmojo/internal/syslog"
 	"logmojo/internal/version"
 
 	"github.com/gofiber/fiber/v2"
@@ -127,6 +130,17 @@ func startServer() {
 	}
 	logger.LogEvent("SYSTEM_START", "system", "Application started")
 
+	// 2.7. Start Receivers (they register their logs before anything reads them)
+	if err := syslog.Start(config.AppConfigData.Syslog); err != nil {
+		log.Fatalf("Failed to start syslog receiver: %v", err)
+	}
+	if err := ingest.Init(config.AppConfigData.Ingest); err != nil {
+		log.Fatalf("Failed to init ingest sources: %v", err)
+	}
+	if err := logs.InitRedaction(); err != nil {
+		log.Fatalf("Failed to init redaction rules: %v", err)
+	}
+
 	// 3. Start Background Tasks
 	metrics.StartHistoryRecorder()
 	alerts.StartAlertEngine()